@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/PagerDuty/godspeed"
 	"github.com/codegangsta/cli"
 )
@@ -8,10 +10,31 @@ import (
 // Flags defines flags for this app
 var Flags = []cli.Flag{
 	cli.StringFlag{Name: "addr", Usage: "Set the address on which to listen", Value: ":8888"},
-	cli.StringFlag{
-		Name:  "bucket-prefix",
-		Value: "net-mozaws-prod-delivery",
-		Usage: "Sets S3 bucket prefix"},
+	cli.StringFlag{Name: "s3-addr", Usage: "Set the address on which to serve the S3 compatible API, disabled if empty"},
+	cli.StringFlag{Name: "s3-bucket", Usage: "Sets the bucket name presented by the S3 compatible API", Value: "archive"},
+	cli.StringFlag{Name: "dav-addr", Usage: "Set the address on which to serve the WebDAV interface, disabled if empty"},
+	cli.DurationFlag{Name: "bucket-map-interval", Usage: "How often the bucket-map file is checked for changes, 0 reloads only on SIGHUP", Value: 30 * time.Second},
+	cli.StringFlag{Name: "local-dir", Usage: "Serves buckets from subdirectories of this directory, named by bucket suffix, instead of S3"},
+	cli.IntFlag{Name: "cache-size", Usage: "Maximum number of cached listings, 0 disables caching", Value: 10000},
+	cli.DurationFlag{Name: "cache-ttl", Usage: "How long listings are cached", Value: time.Minute},
+	cli.StringSliceFlag{
+		Name:  "mount-cache-ttl",
+		Value: &cli.StringSlice{},
+		Usage: "Overrides cache-ttl for a mount, format: prefix=duration (ie pub/firefox/=5m)"},
+	cli.IntFlag{Name: "breaker-threshold", Usage: "Consecutive S3 failures before a bucket's circuit breaker opens", Value: 5},
+	cli.DurationFlag{Name: "breaker-cooldown", Usage: "How long an open circuit breaker rejects calls", Value: 30 * time.Second},
+	cli.StringFlag{Name: "file-mode", Usage: "How files are served: proxy, presign or a CDN base URL to redirect to", Value: "proxy"},
+	cli.StringSliceFlag{
+		Name:  "mount-file-mode",
+		Value: &cli.StringSlice{},
+		Usage: "Overrides file-mode for a mount, format: prefix=mode (ie pub/firefox/=presign)"},
+	cli.IntFlag{Name: "archive-max-size", Usage: "Maximum total size in MiB of a directory archive, 0 disables archives", Value: 2048},
+	cli.IntFlag{Name: "archive-max-objects", Usage: "Maximum number of objects in a directory archive", Value: 1000},
+	cli.StringSliceFlag{
+		Name:  "archive-disabled-mount",
+		Value: &cli.StringSlice{},
+		Usage: "Disables directory archives for a mount (ie pub/firefox/)"},
+	cli.IntFlag{Name: "diff-max-objects", Usage: "Maximum number of objects in each directory of a diff", Value: 10000},
 	cli.StringFlag{Name: "logger", Usage: "Sets the logger name", Value: "BucketLister"},
 	cli.StringFlag{Name: "dogstatsd-ip", Usage: "Dogstatsd IP", Value: godspeed.DefaultHost},
 	cli.StringFlag{Name: "dogstatsd-namespace", Usage: "Dogstatsd NameSpace", Value: "bucketlister"},
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
-	"sort"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -27,26 +28,49 @@ func main() {
 		},
 	}
 	app.Action = doMain
-	app.Flags = Flags
+	app.Flags = append(append(Flags, deliverytools.EnvFlags...), deliverytools.AWSFlags...)
 
 	app.RunAndExitOnError()
 }
 
-func mountListers(rootLister *services.BucketLister, listers []*services.BucketLister) {
-	sort.Sort(sort.Reverse(services.SortMountedAt(listers)))
-	for _, l := range listers {
-		mountTo := rootLister
-		for _, other := range listers {
-			if l == other {
-				continue
-			}
-			if strings.HasPrefix(l.Mount(), other.Mount()) {
-				mountTo = other
-				break
-			}
+// mountPath returns the mount point of a mount prefix
+func mountPath(prefix string) string {
+	mount := "/"
+	if trimmed := strings.Trim(prefix, "/"); trimmed != "" {
+		mount += trimmed + "/"
+	}
+	return mount
+}
+
+func parseMountCacheTTLs(values []string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid mount-cache-ttl %q, expected prefix=duration", v)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mount-cache-ttl %q: %s", v, err)
+		}
+		ttls[mountPath(parts[0])] = d
+	}
+	return ttls, nil
+}
+
+func parseMountFileModes(values []string) (map[string]string, error) {
+	modes := make(map[string]string)
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid mount-file-mode %q, expected prefix=mode", v)
+		}
+		if err := services.ValidFileMode(parts[1]); err != nil {
+			return nil, err
 		}
-		mountTo.AddBucketLister(l)
+		modes[mountPath(parts[0])] = parts[1]
 	}
+	return modes, nil
 }
 
 func doMain(c *cli.Context) {
@@ -58,35 +82,155 @@ func doMain(c *cli.Context) {
 			Port:      c.Int("dogstatsd-port"),
 		}
 	}
-	rootLister := services.NewBucketLister(
-		c.String("bucket-prefix")+"-"+deliverytools.ProdBucketMap.Default,
-		"",
-		deliverytools.AWSSession,
-	)
 
-	listers := []*services.BucketLister{}
-	lister := func(suffix, prefix string) http.Handler {
-		bl := services.NewBucketLister(
-			c.String("bucket-prefix")+"-"+suffix, prefix, deliverytools.AWSSession)
+	mountTTLs, err := parseMountCacheTTLs(c.StringSlice("mount-cache-ttl"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := services.ValidFileMode(c.String("file-mode")); err != nil {
+		log.Fatal(err)
+	}
+	mountFileModes, err := parseMountFileModes(c.StringSlice("mount-file-mode"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	archiveDisabled := make(map[string]bool)
+	for _, prefix := range c.StringSlice("archive-disabled-mount") {
+		archiveDisabled[mountPath(prefix)] = true
+	}
+
+	var cache *services.ListingCache
+	if c.Int("cache-size") > 0 {
+		cache = services.NewListingCache(c.Int("cache-size"))
+	}
+	env, err := deliverytools.EnvironmentFromContext(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Serving the %s environment, bucket prefix: %s", env.Name, env.BucketPrefix)
+
+	storages := make(map[string]services.Storage)
+	storageFor := func(suffix string) (services.Storage, error) {
+		if storages[suffix] == nil {
+			if c.String("local-dir") != "" {
+				storages[suffix] = services.NewLocalStorage(filepath.Join(c.String("local-dir"), suffix))
+			} else {
+				bucket := env.Bucket(suffix)
+				awsSession, err := env.AWS.Session(bucket)
+				if err != nil {
+					return nil, err
+				}
+				storages[suffix] = services.NewS3Storage(bucket, awsSession)
+			}
+		}
+		return storages[suffix], nil
+	}
+
+	breakers := make(map[string]*services.CircuitBreaker)
+	configureLister := func(bl *services.BucketLister) {
+		if breakers[bl.Bucket] == nil {
+			breakers[bl.Bucket] = services.NewCircuitBreaker(
+				bl.Bucket, c.Int("breaker-threshold"), c.Duration("breaker-cooldown"))
+		}
+		bl.Breaker = breakers[bl.Bucket]
+		bl.Cache = cache
+		bl.CacheTTL = c.Duration("cache-ttl")
+		if ttl, ok := mountTTLs[bl.Mount()]; ok {
+			bl.CacheTTL = ttl
+		}
+		bl.FileMode = c.String("file-mode")
+		if mode, ok := mountFileModes[bl.Mount()]; ok {
+			bl.FileMode = mode
+		}
+		if c.Int("archive-max-size") > 0 && !archiveDisabled[bl.Mount()] {
+			bl.Archive = &services.ArchiveLimits{
+				MaxSize:    int64(c.Int("archive-max-size")) << 20,
+				MaxObjects: c.Int("archive-max-objects"),
+			}
+		}
+	}
+
+	site := new(handlerSwitch)
+	s3API := new(handlerSwitch)
+	dav := new(handlerSwitch)
+
+	// build replaces the lister tree with one of bucketMap
+	build := func(bucketMap deliverytools.BucketMap) error {
+		tree, err := bucketMap.Tree()
+		if err != nil {
+			return err
+		}
 
-		listers = append(listers, bl)
-		return bl
+		mux := http.NewServeMux()
+		apiStorage := make(map[string]services.Storage)
+		rootLister, err := services.NewListerTree(tree, func(suffix, mountedAt string) (*services.BucketLister, error) {
+			storage, err := storageFor(suffix)
+			if err != nil {
+				return nil, err
+			}
+			apiStorage[suffix] = storage
+
+			bl := services.NewBucketLister(env.Bucket(suffix), mountedAt, storage)
+			configureLister(bl)
+			if mountedAt != "" {
+				mux.Handle(mountedAt, bl)
+			}
+			return bl, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			startTime := time.Now()
+			rootLister.ServeHTTP(w, r)
+			duration := time.Now().Sub(startTime)
+			go metrics.Metric.Set("pageload", float64(duration/time.Nanosecond), []string{})
+		}))
+		differ := services.NewDirDiff(rootLister)
+		differ.MaxObjects = c.Int("diff-max-objects")
+		mux.Handle("/diff", differ)
+
+		site.Set(mux)
+		s3API.Set(services.NewS3API(c.String("s3-bucket"), tree, apiStorage))
+		dav.Set(services.NewWebDAV(rootLister))
+		return nil
 	}
 
-	http.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
-		rootLister.ServeHTTP(w, r)
-		duration := time.Now().Sub(startTime)
-		go metrics.Metric.Set("pageload", float64(duration/time.Nanosecond), []string{})
-	}))
+	if err := build(env.BucketMap); err != nil {
+		log.Fatal(err)
+	}
+
+	if path := c.String(deliverytools.BucketMapFlag.Name); path != "" {
+		go watchFile(path, c.Duration("bucket-map-interval"), func() {
+			bucketMap, err := deliverytools.LoadBucketMap(path)
+			if err == nil {
+				err = build(bucketMap)
+			}
+			if err != nil {
+				log.Printf("Error reloading bucket map, keeping the previous one err: %s", err)
+				go metrics.Metric.Count("bucketmap.reload_error", 1, []string{})
+				return
+			}
+			go metrics.Metric.Count("bucketmap.reload", 1, []string{})
+		})
+	}
 
-	for _, mount := range deliverytools.ProdBucketMap.Mounts {
-		http.Handle("/"+mount.Prefix, lister(mount.Bucket, "/"+mount.Prefix))
+	if c.String("s3-addr") != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(c.String("s3-addr"), s3API))
+		}()
 	}
 
-	mountListers(rootLister, listers)
+	if c.String("dav-addr") != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(c.String("dav-addr"), dav))
+		}()
+	}
 
-	err := http.ListenAndServe(c.String("addr"), nil)
+	err = http.ListenAndServe(c.String("addr"), site)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// handlerSwitch serves requests with the most recently set handler
+//
+// Requests in flight when the handler is replaced finish with the old one.
+type handlerSwitch struct {
+	handler atomic.Value
+}
+
+type storedHandler struct {
+	http.Handler
+}
+
+// Set replaces the handler of h
+func (h *handlerSwitch) Set(handler http.Handler) {
+	h.handler.Store(storedHandler{handler})
+}
+
+// ServeHTTP implements http.Handler
+func (h *handlerSwitch) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.handler.Load().(storedHandler).ServeHTTP(w, req)
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Error checking %s err: %s", path, err)
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// watchFile calls reload on SIGHUP and, if interval is not 0, when the
+// modification time of path changes
+func watchFile(path string, interval time.Duration, reload func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		tick = time.NewTicker(interval).C
+	}
+
+	lastMod := modTime(path)
+	for {
+		select {
+		case <-hup:
+			log.Printf("Reloading %s on SIGHUP", path)
+		case <-tick:
+			mod := modTime(path)
+			if mod.IsZero() || mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			log.Printf("Reloading %s, modified at %s", path, mod)
+		}
+		reload()
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerSwitch(t *testing.T) {
+	h := new(handlerSwitch)
+	h.Set(http.NotFoundHandler())
+
+	req, err := http.NewRequest("GET", "/", nil)
+	assert.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, 404, recorder.Code)
+
+	h.Set(http.RedirectHandler("/other", http.StatusFound))
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, 302, recorder.Code)
+}
+
+func TestWatchFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "bucketmap")
+	assert.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	reloads := make(chan bool, 10)
+	go watchFile(f.Name(), 10*time.Millisecond, func() { reloads <- true })
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, reloads, 0, "unmodified files are not reloaded")
+
+	assert.NoError(t, os.Chtimes(f.Name(), time.Now(), time.Now().Add(time.Minute)))
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Error("modified file was not reloaded")
+	}
+}
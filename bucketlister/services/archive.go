@@ -0,0 +1,205 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/mozilla-services/product-delivery-tools/metrics"
+)
+
+// ArchiveLimits bounds the directories which may be downloaded as archives
+type ArchiveLimits struct {
+	// MaxSize is the largest total size of the archived objects in bytes
+	MaxSize int64
+
+	// MaxObjects is the largest number of archived objects
+	MaxObjects int
+}
+
+// archiveTooLargeError is returned when a directory exceeds ArchiveLimits
+type archiveTooLargeError string
+
+func (e archiveTooLargeError) Error() string {
+	return string(e)
+}
+
+// archiveObject is an object to be added to an archive
+type archiveObject struct {
+	lister *BucketLister
+	name   string
+	obj    *Object
+}
+
+type archiveWriter interface {
+	add(name string, obj *Object, body io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (z *zipArchive) add(name string, obj *Object, body io.Reader) error {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	header.SetModTime(obj.LastModified)
+	f, err := z.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	return err
+}
+
+type tarGzArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (t *tarGzArchive) add(name string, obj *Object, body io.Reader) error {
+	err := t.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     obj.Size,
+		ModTime:  obj.LastModified,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.tw, body)
+	return err
+}
+
+func (t *tarGzArchive) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// serveArchive writes the requested directory as a zip or tar.gz archive if
+// ?archive is set
+//
+// The directory is walked, including mounted listers, and checked against
+// b.Archive before anything is written. Objects are then copied from
+// storage into the archive one at a time.
+func (b *BucketLister) serveArchive(w http.ResponseWriter, req *http.Request) bool {
+	format := req.URL.Query().Get("archive")
+	if format == "" {
+		return false
+	}
+
+	var contentType string
+	switch format {
+	case "zip":
+		contentType = "application/zip"
+	case "tar.gz":
+		contentType = "application/gzip"
+	default:
+		writeError(w, req, invalidArgumentError(fmt.Sprintf("invalid archive %q", format)))
+		return true
+	}
+
+	reqPath := req.URL.Path
+	if !strings.HasSuffix(reqPath, "/") {
+		reqPath += "/"
+	}
+	lister := b.listerFor(reqPath)
+
+	if lister.Archive == nil {
+		writeError(w, req, &s3Error{Op: "archiving", Bucket: lister.Bucket, Key: lister.keyPrefix(reqPath),
+			Err: awserr.New("AccessDenied", "archives are disabled", nil)})
+		return true
+	}
+
+	objects, err := lister.archiveObjects(reqPath)
+	if err != nil {
+		writeError(w, req, err)
+		return true
+	}
+	if len(objects) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Not Found"))
+		return true
+	}
+
+	name := path.Base(reqPath)
+	if name == "/" {
+		name = "archive"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	w.WriteHeader(http.StatusOK)
+	if req.Method == "HEAD" {
+		return true
+	}
+	go metrics.Metric.Count("archive."+format, 1, []string{"bucket:" + lister.Bucket})
+
+	var archive archiveWriter
+	if format == "zip" {
+		archive = &zipArchive{zip.NewWriter(w)}
+	} else {
+		gz := gzip.NewWriter(w)
+		archive = &tarGzArchive{tw: tar.NewWriter(gz), gz: gz}
+	}
+
+	for _, o := range objects {
+		if err := o.copyTo(archive, name+"/"+o.name); err != nil {
+			log.Printf("Archive %s/%s was interrupted err: %s", lister.Bucket, lister.keyPrefix(reqPath), err)
+			return true
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Error closing archive %s/%s err: %s", lister.Bucket, lister.keyPrefix(reqPath), err)
+	}
+	return true
+}
+
+// archiveObjects returns the objects below reqPath, or archiveTooLargeError
+// if they exceed b.Archive
+func (b *BucketLister) archiveObjects(reqPath string) ([]*archiveObject, error) {
+	objects := []*archiveObject{}
+	size := int64(0)
+
+	err := b.walk(reqPath, func(p string, obj *Object) error {
+		if strings.HasSuffix(p, "/") {
+			// directory placeholder
+			return nil
+		}
+		size += obj.Size
+		if len(objects) >= b.Archive.MaxObjects {
+			return archiveTooLargeError(fmt.Sprintf("%s has more than %d objects", reqPath, b.Archive.MaxObjects))
+		}
+		if size > b.Archive.MaxSize {
+			return archiveTooLargeError(fmt.Sprintf("%s is larger than %d bytes", reqPath, b.Archive.MaxSize))
+		}
+		objects = append(objects, &archiveObject{
+			lister: b.listerFor(p),
+			name:   strings.TrimPrefix(p, reqPath),
+			obj:    obj,
+		})
+		return nil
+	})
+	return objects, err
+}
+
+func (o *archiveObject) copyTo(archive archiveWriter, name string) error {
+	res, err := o.lister.Storage.Open(o.obj.Key, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return archive.add(name, o.obj, res.Body)
+}
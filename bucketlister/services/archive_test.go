@@ -0,0 +1,76 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketListerArchive(t *testing.T) {
+	bl := NewBucketLister("firefox", "/pub/firefox/", newMemStorage(memObjects(
+		"pub/firefox/releases/1.0/linux/a.xpi",
+		"pub/firefox/releases/1.0/linux/sub/b.xpi",
+		"pub/firefox/releases/1.0/mac/c.xpi",
+	)...))
+	archive := func(url string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", url, nil)
+		assert.NoError(t, err)
+		bl.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := archive("/pub/firefox/releases/1.0/linux/?archive=zip")
+	assert.Equal(t, 403, recorder.Code)
+
+	bl.Archive = &ArchiveLimits{MaxSize: 1 << 20, MaxObjects: 10}
+
+	recorder = archive("/pub/firefox/releases/1.0/linux/?archive=zip")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, `attachment; filename="linux.zip"`, recorder.Header().Get("Content-Disposition"))
+	body := recorder.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if assert.NoError(t, err) && assert.Len(t, zr.File, 2) {
+		assert.Equal(t, "linux/a.xpi", zr.File[0].Name)
+		assert.Equal(t, "linux/sub/b.xpi", zr.File[1].Name)
+		f, err := zr.File[1].Open()
+		assert.NoError(t, err)
+		content, _ := ioutil.ReadAll(f)
+		assert.Equal(t, "pub/firefox/releases/1.0/linux/sub/b.xpi", string(content))
+	}
+
+	recorder = archive("/pub/firefox/releases/1.0/?archive=tar.gz")
+	assert.Equal(t, 200, recorder.Code)
+	gz, err := gzip.NewReader(recorder.Body)
+	if assert.NoError(t, err) {
+		tr := tar.NewReader(gz)
+		names := []string{}
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			names = append(names, header.Name)
+		}
+		assert.Equal(t, []string{"1.0/linux/a.xpi", "1.0/linux/sub/b.xpi", "1.0/mac/c.xpi"}, names)
+	}
+
+	bl.Archive.MaxObjects = 2
+	recorder = archive("/pub/firefox/releases/1.0/?archive=zip")
+	assert.Equal(t, 413, recorder.Code)
+
+	recorder = archive("/pub/firefox/releases/1.0/?archive=rar")
+	assert.Equal(t, 400, recorder.Code)
+
+	recorder = archive("/pub/firefox/releases/2.0/?archive=zip")
+	assert.Equal(t, 404, recorder.Code)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mozilla-services/product-delivery-tools/metrics"
+)
+
+// ErrCircuitOpen is returned when a call is rejected by an open CircuitBreaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calls to a failing backend
+//
+// After Threshold consecutive failures the breaker opens and rejects calls
+// for Cooldown. A single trial call is then allowed through; its result
+// closes or reopens the breaker.
+type CircuitBreaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker returns a closed *CircuitBreaker
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:      name,
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		state:     breakerClosed,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the call should not be made
+func (c *CircuitBreaker) Allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case breakerOpen:
+		if time.Since(c.openedAt) < c.Cooldown {
+			return ErrCircuitOpen
+		}
+		c.setState(breakerHalfOpen)
+		return nil
+	case breakerHalfOpen:
+		// a trial call is already in flight
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Success records a successful call
+func (c *CircuitBreaker) Success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures = 0
+	if c.state != breakerClosed {
+		c.setState(breakerClosed)
+	}
+}
+
+// Failure records a failed call
+func (c *CircuitBreaker) Failure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	if c.state == breakerHalfOpen || (c.state == breakerClosed && c.failures >= c.Threshold) {
+		c.openedAt = time.Now()
+		c.setState(breakerOpen)
+	}
+}
+
+// State returns the current state of the breaker
+func (c *CircuitBreaker) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// setState changes the state, c.mu must be held
+func (c *CircuitBreaker) setState(state string) {
+	log.Printf("Circuit breaker %s: %s -> %s, consecutive failures: %d", c.Name, c.state, state, c.failures)
+	go metrics.Metric.Count("circuit_breaker."+state, 1, []string{"breaker:" + c.Name})
+	c.state = state
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker("test", 2, 20*time.Millisecond)
+
+	assert.NoError(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, breakerClosed, b.State())
+	b.Success()
+	b.Failure()
+	assert.Equal(t, breakerClosed, b.State(), "success should reset failures")
+
+	b.Failure()
+	assert.Equal(t, breakerOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, b.Allow(), "trial call should be allowed after cooldown")
+	assert.Equal(t, breakerHalfOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.Allow(), "only one trial call")
+
+	b.Failure()
+	assert.Equal(t, breakerOpen, b.State(), "failed trial should reopen")
+
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, b.Allow())
+	b.Success()
+	assert.Equal(t, breakerClosed, b.State())
+	assert.NoError(t, b.Allow())
+}
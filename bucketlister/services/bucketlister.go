@@ -3,18 +3,19 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mozilla-services/product-delivery-tools"
+	"github.com/mozilla-services/product-delivery-tools/metrics"
+	"github.com/mozilla-services/product-delivery-tools/mozversion"
 )
 
 // SortMountedAt sorts a slice of bucketlisters by mountedAt
@@ -34,19 +35,37 @@ type BucketLister struct {
 
 	listers []*BucketLister
 
-	AWSSession *session.Session
+	Storage Storage
+
+	// Cache stores listings for CacheTTL, if nil listings are not cached
+	Cache    *ListingCache
+	CacheTTL time.Duration
+
+	// Breaker, if set, stops listing calls to a failing bucket
+	Breaker *CircuitBreaker
+
+	// Archive limits directory archives, if nil archives are disabled
+	Archive *ArchiveLimits
+
+	// FileMode is how requests for objects are served, FileProxy,
+	// FilePresign or a CDN base URL
+	FileMode string
 }
 
+// staleExpiresIn is the max-age of listings served from a stale cache entry
+const staleExpiresIn = 30 * time.Second
+
 // NewBucketLister returns a *BucketLister
 //
-// prefix is the starting point for this lister
-func NewBucketLister(bucket, prefix string, awsSession *session.Session) *BucketLister {
+// bucket names storage in caches, metrics and logs. prefix is the starting
+// point for this lister
+func NewBucketLister(bucket, prefix string, storage Storage) *BucketLister {
 	trimmedPrefix := strings.Trim(prefix, "/")
 	if trimmedPrefix != "" {
 		trimmedPrefix += "/"
 	}
 	return &BucketLister{
-		AWSSession: awsSession,
+		Storage:    storage,
 		Bucket:     bucket,
 		mountedAt:  "/" + trimmedPrefix,
 		basePrefix: trimmedPrefix,
@@ -65,30 +84,65 @@ func (b *BucketLister) AddBucketLister(child *BucketLister) {
 	b.listers = append(b.listers, child)
 }
 
-// Empty returns true if the bucket contains zero keys
-func (b *BucketLister) Empty() (bool, error) {
-	listParams := &s3.ListObjectsInput{
-		Bucket:  aws.String(b.Bucket),
-		MaxKeys: aws.Int64(1),
+// NewListerTree returns the lister of tree's root, made by newLister with
+// every mount's lister added to the lister of its parent mount
+//
+// newLister is called with the bucket and mount path of each mount, the
+// mount path of the root is empty.
+func NewListerTree(tree *deliverytools.MountTree, newLister func(bucket, mountedAt string) (*BucketLister, error)) (*BucketLister, error) {
+	listers := make(map[*deliverytools.MountTree]*BucketLister)
+	var err error
+	tree.Walk(func(mount, parent *deliverytools.MountTree) {
+		if err != nil {
+			return
+		}
+		mountedAt := ""
+		if parent != nil {
+			mountedAt = "/" + mount.Prefix
+		}
+		var bl *BucketLister
+		if bl, err = newLister(mount.Bucket, mountedAt); err != nil {
+			return
+		}
+		listers[mount] = bl
+		if parent != nil {
+			listers[parent].AddBucketLister(bl)
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	return listers[tree], nil
+}
 
-	s3Service := s3.New(b.AWSSession)
-	res, err := s3Service.ListObjects(listParams)
+// Empty returns true if the bucket contains zero keys
+func (b *BucketLister) Empty() (bool, error) {
+	res, err := b.Storage.List(&ListInput{Limit: 1})
 	if err != nil {
-		return true, fmt.Errorf("listing %s err: %s", b.Bucket, err)
+		return true, err
 	}
 
-	return len(res.Contents) <= 0, nil
+	return len(res.Objects) <= 0, nil
 }
 
-func objectToListFileInfo(obj *s3.Object) *File {
+func objectToListFileInfo(obj *Object) *File {
 	return &File{
-		Name:         *obj.Key,
-		LastModified: *obj.LastModified,
-		Size:         *obj.Size,
+		Name:         obj.Key,
+		LastModified: obj.LastModified,
+		Size:         obj.Size,
 	}
 }
 
+// listerFor returns the lister mounted closest to reqPath
+func (b *BucketLister) listerFor(reqPath string) *BucketLister {
+	for _, lister := range b.listers {
+		if strings.HasPrefix(reqPath, lister.mountedAt) {
+			return lister.listerFor(reqPath)
+		}
+	}
+	return b
+}
+
 // Mount returns the mount point of this lister
 func (b *BucketLister) Mount() string {
 	return b.mountedAt
@@ -114,66 +168,251 @@ func (b *BucketLister) listerDirs(reqPath string) []string {
 	return res
 }
 
-func deduplicateSlice(slice []string) []string {
-	keys := make(map[string]bool)
-	for _, k := range slice {
-		keys[k] = true
+// addPage adds one page of storage results to listing
+//
+// seen tracks prefixes already added so that prefixes are unique across
+// pages.
+func (p *PrefixListing) addPage(prefix string, page *ListOutput, seen map[string]bool) {
+	for _, cp := range page.Prefixes {
+		dir := path.Base(cp) + "/"
+		if !seen[dir] {
+			seen[dir] = true
+			p.Prefixes = append(p.Prefixes, dir)
+		}
 	}
-	result := make([]string, 0, len(keys))
-	for k := range keys {
-		result = append(result, k)
+
+	for _, o := range page.Objects {
+		o := objectToListFileInfo(o)
+		o.Name = strings.TrimPrefix(o.Name, prefix)
+		p.Files = append(p.Files, o)
 	}
-	return result
 }
 
-func (b *BucketLister) listPrefix(reqPath, prefix string) (*PrefixListing, error) {
-	s3Service := s3.New(b.AWSSession)
-	objects, prefixes, err := listObjects(s3Service, b.Bucket, prefix)
-	if err != nil {
-		return nil, err
+// pageFunc is called with each page of a listing as it arrives from storage
+//
+// It cannot fail the listing, which may be shared by several requests.
+type pageFunc func(page *PrefixListing, last bool)
+
+// listPrefix returns the listing for prefix
+//
+// If listing fails and a previous listing is cached, it is returned with
+// stale set to true. onPage, if not nil, is called with each page when the
+// listing is fetched from storage rather than the cache.
+func (b *BucketLister) listPrefix(reqPath, prefix string, onPage pageFunc) (listing *PrefixListing, stale bool, err error) {
+	if b.Cache == nil {
+		listing, err = b.fetchPrefix(reqPath, prefix, onPage)
+		return listing, false, err
+	}
+
+	listing, err = b.Cache.Get(b.Bucket, prefix, b.CacheTTL, func() (*PrefixListing, error) {
+		return b.fetchPrefix(reqPath, prefix, onPage)
+	})
+	if err == nil {
+		return listing, false, nil
 	}
 
-	extraDirs := b.listerDirs(reqPath)
+	if listing = b.Cache.Stale(b.Bucket, prefix); listing != nil {
+		log.Printf("Serving stale listing for %s/%s, err: %s", b.Bucket, prefix, err)
+		go metrics.Metric.Count("listing.stale", 1, []string{"bucket:" + b.Bucket})
+		return listing, true, nil
+	}
+	return nil, false, err
+}
 
+// listCall makes a listing call of prefix through b.Breaker
+func (b *BucketLister) listCall(prefix string, call func() error) error {
+	if b.Breaker != nil {
+		if err := b.Breaker.Allow(); err != nil {
+			return &s3Error{Op: "listing", Bucket: b.Bucket, Key: prefix, Err: err}
+		}
+	}
+
+	err := call()
+	if b.Breaker != nil {
+		if err != nil && isBackendFailure(err) {
+			b.Breaker.Failure()
+		} else {
+			b.Breaker.Success()
+		}
+	}
+	return err
+}
+
+// listObjectsPage lists a single page of the directory prefix through
+// b.Breaker
+func (b *BucketLister) listObjectsPage(prefix, token string, limit int64) (page *ListOutput, err error) {
+	err = b.listCall(prefix, func() (err error) {
+		page, err = b.Storage.List(&ListInput{
+			Prefix:    prefix,
+			Delimiter: "/",
+			Token:     token,
+			Limit:     limit,
+		})
+		return err
+	})
+	return page, err
+}
+
+func (b *BucketLister) fetchPrefix(reqPath, prefix string, onPage pageFunc) (*PrefixListing, error) {
 	listing := &PrefixListing{
-		Prefixes: make([]string, len(prefixes), len(prefixes)+len(extraDirs)),
-		Files:    make([]*File, 0, len(objects)),
+		Prefixes: []string{},
+		Files:    []*File{},
 	}
+	seen := make(map[string]bool)
+
+	token := ""
+	for first := true; first || token != ""; first = false {
+		res, err := b.listObjectsPage(prefix, token, 0)
+		if err != nil {
+			return nil, err
+		}
+		next := res.Next
 
-	for i, p := range prefixes {
-		listing.Prefixes[i] = path.Base(*p.Prefix) + "/"
+		page := &PrefixListing{}
+		if first {
+			for _, dir := range b.listerDirs(reqPath) {
+				seen[dir] = true
+				page.Prefixes = append(page.Prefixes, dir)
+			}
+		}
+		page.addPage(prefix, res, seen)
+		sort.Sort(mozversion.Slice(page.Prefixes))
+
+		listing.Prefixes = append(listing.Prefixes, page.Prefixes...)
+		listing.Files = append(listing.Files, page.Files...)
+
+		if onPage != nil {
+			onPage(page, next == "")
+		}
+		token = next
 	}
 
-	listing.Prefixes = deduplicateSlice(append(listing.Prefixes, extraDirs...))
+	sort.Sort(mozversion.Slice(listing.Prefixes))
+	return listing, nil
+}
 
-	sort.Strings(listing.Prefixes)
+// listPage returns a single page of at most limit entries starting at the
+// continuation token after
+//
+// Pages are not cached. Mounted listers are only included on the first page.
+func (b *BucketLister) listPage(reqPath, prefix, after string, limit int64) (*PrefixListing, error) {
+	res, err := b.listObjectsPage(prefix, after, limit)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, o := range objects {
-		o := objectToListFileInfo(o)
-		o.Name = strings.TrimPrefix(o.Name, prefix)
-		listing.Files = append(listing.Files, o)
+	listing := &PrefixListing{
+		Prefixes: []string{},
+		Files:    []*File{},
+		Next:     res.Next,
+	}
+	seen := make(map[string]bool)
+	if after == "" {
+		for _, dir := range b.listerDirs(reqPath) {
+			seen[dir] = true
+			listing.Prefixes = append(listing.Prefixes, dir)
+		}
 	}
+	listing.addPage(prefix, res, seen)
+	sort.Sort(mozversion.Slice(listing.Prefixes))
 
 	return listing, nil
 }
 
+// keyPrefix returns the S3 prefix of reqPath, which must end with a slash
+func (b *BucketLister) keyPrefix(reqPath string) string {
+	relPath := strings.TrimPrefix(reqPath, b.mountedAt)
+	prefix := path.Join(b.basePrefix, relPath)
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix
+}
+
 // ServeHTTP implements http.Handler
 func (b *BucketLister) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if b.serveLatest(w, req) {
+		return
+	}
+	if b.serveManifest(w, req) {
+		return
+	}
+	if b.serveArchive(w, req) {
+		return
+	}
+	if b.serveFile(w, req) {
+		return
+	}
+
 	reqPath := req.URL.Path
 	if !strings.HasSuffix(reqPath, "/") {
 		reqPath += "/"
 	}
-	relPath := strings.TrimPrefix(reqPath, b.mountedAt)
-	prefix := path.Join(b.basePrefix, relPath)
-	if prefix != "" {
-		prefix += "/"
+	prefix := b.keyPrefix(reqPath)
+
+	limit, after, err := parsePagination(req)
+	if err != nil {
+		writeError(w, req, err)
+		return
 	}
 
-	listing, err := b.listPrefix(reqPath, prefix)
+	opts, err := parseListOptions(req)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Internal Server Error."))
-		log.Printf("Error %s", err)
+		writeError(w, req, err)
+		return
+	}
+
+	format, err := negotiateFormat(req)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+
+	tmplParams := &listTemplateInput{
+		Path:    reqPath,
+		Limit:   limit,
+		Options: *opts,
+	}
+
+	if limit > 0 {
+		listing, err := b.listPage(reqPath, prefix, after, limit)
+		if err != nil {
+			writeError(w, req, err)
+			return
+		}
+		if after == "" && reqPath != b.mountedAt && len(listing.Files) == 0 && len(listing.Prefixes) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Not Found"))
+			return
+		}
+		tmplParams.PrefixListing = opts.Apply(listing)
+		b.writeListing(w, req, format, tmplParams, false)
+		return
+	}
+
+	// Unpaginated HTML listings are streamed if they span several S3 pages
+	var streamer *listingStreamer
+	var onPage pageFunc
+	if req.Method == "GET" && format == htmlFormat && opts.IsDefault() {
+		streamer = &listingStreamer{
+			lister: b,
+			w:      w,
+			req:    req,
+			prefix: prefix,
+			path:   reqPath,
+		}
+		onPage = streamer.onPage
+	}
+
+	listing, stale, err := b.listPrefix(reqPath, prefix, onPage)
+	if streamer != nil && streamer.started {
+		if !streamer.finished {
+			log.Printf("Streaming listing %s/%s was interrupted", b.Bucket, prefix)
+		}
+		return
+	}
+	if err != nil {
+		writeError(w, req, err)
 		return
 	}
 
@@ -186,42 +425,71 @@ func (b *BucketLister) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if file := listing.HasFile("index.html"); file != nil {
 		setExpiresIn(15*time.Minute, w)
 		w.Header().Set("Content-Type", "text/html")
-
-		s3Service := s3.New(b.AWSSession)
-		params := &s3.GetObjectInput{
-			Bucket: aws.String(b.Bucket),
-			Key:    aws.String(prefix + file.Name),
+		if err := proxyObject(w, req, b.Storage, prefix+file.Name); err != nil {
+			writeError(w, req, err)
 		}
+		return
+	}
 
-		resp, err := s3Service.GetObject(params)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Internal Server Error."))
-			log.Printf("Error %s", err)
-			return
-		}
-		if resp.Body != nil {
-			defer resp.Body.Close()
-			io.Copy(w, resp.Body)
+	tmplParams.PrefixListing = opts.Apply(listing)
+	b.writeListing(w, req, format, tmplParams, stale)
+}
+
+// writeListing renders input.PrefixListing in format
+func (b *BucketLister) writeListing(w http.ResponseWriter, req *http.Request, format *listingFormat, input *listTemplateInput, stale bool) {
+	listing := input.PrefixListing
+
+	var feed *atomFeed
+	tag := listing.ETag()
+	if format == atomFormat {
+		// feeds include the contents of subdirectories
+		feed = b.listingFeed(req, input)
+		tag = feedETag(feed)
+	}
+
+	etag := fmt.Sprintf(`"%s-%s"`, tag, format.Name)
+	lastModified := listing.LastModified()
+	setHeaders := func() {
+		if stale {
+			setExpiresIn(staleExpiresIn, w)
+			w.Header().Set("Warning", `110 - "Response is Stale"`)
+		} else {
+			setExpiresIn(15*time.Minute, w)
 		}
+		setValidators(etag, lastModified, w)
+		setVary(req, w)
+		w.Header().Set("Content-Type", format.ContentType)
+	}
+
+	if notModified(req, etag, lastModified) {
+		setHeaders()
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	contentType := "text/html"
+	var err error
 	body := new(bytes.Buffer)
-	switch req.Header.Get("Accept") {
-	case "application/json":
-		contentType = "application/json"
-		err := json.NewEncoder(body).Encode(listing)
+	switch format {
+	case atomFormat:
+		body.WriteString(xml.Header)
+		err = xml.NewEncoder(body).Encode(feed)
+		if err != nil {
+			log.Printf("Error encoding Atom err: %s", err)
+		}
+	case textFormat:
+		err = writeTextListing(body, req, input)
+	case csvFormat:
+		err = writeCSVListing(body, input)
+		if err != nil {
+			log.Printf("Error encoding CSV err: %s", err)
+		}
+	case jsonFormat:
+		err = json.NewEncoder(body).Encode(listing)
 		if err != nil {
 			log.Printf("Error encoding JSON err: %s", err)
 		}
 	default:
-		tmplParams := &listTemplateInput{
-			Path:          reqPath,
-			PrefixListing: listing,
-		}
-		err = listTemplate.Execute(body, tmplParams)
+		err = listTemplate.Execute(body, input)
 		if err != nil {
 			log.Printf("Error executing template err: %s", err)
 		}
@@ -233,8 +501,10 @@ func (b *BucketLister) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	setExpiresIn(15*time.Minute, w)
-	w.Header().Set("Vary", "Accept")
-	w.Header().Set("Content-Type", contentType)
+	setHeaders()
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	if req.Method == "HEAD" {
+		return
+	}
 	w.Write(body.Bytes())
 }
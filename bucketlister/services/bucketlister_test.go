@@ -2,51 +2,29 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
-	deliverytools "github.com/mozilla-services/product-delivery-tools"
 	"github.com/stretchr/testify/assert"
 )
 
-func listMirror(objects []*s3.Object, prefixes []*s3.CommonPrefix, err error) func(*s3.S3, string, string) ([]*s3.Object, []*s3.CommonPrefix, error) {
-	return func(svc *s3.S3, bucket, prefix string) ([]*s3.Object, []*s3.CommonPrefix, error) {
-		return objects, prefixes, err
-	}
-}
-
 func TestBucketPrefix(t *testing.T) {
-	now := time.Now()
-	listObjects = listMirror(
-		[]*s3.Object{
-			&s3.Object{
-				Key:          aws.String("key1"),
-				LastModified: &now,
-				Size:         aws.Int64(2048),
-			},
-			&s3.Object{
-				Key:          aws.String("/pub/firebird/MozillaFirebird-i686-linux-gtk2+xft.tar.gz"),
-				LastModified: &now,
-				Size:         aws.Int64(2048),
-			},
-			&s3.Object{
-				Key:          aws.String("/pub/firebird/MozillaFirebird:i686-linux-gtk2+xft.tar.gz"),
-				LastModified: &now,
-				Size:         aws.Int64(2048),
-			},
-		},
-		[]*s3.CommonPrefix{
-			&s3.CommonPrefix{
-				Prefix: aws.String("prefix+1"),
-			},
-		},
-		nil,
+	objects := memObjects(
+		"prefix/pre+fix/key1",
+		"prefix/pre+fix/MozillaFirebird-i686-linux-gtk2+xft.tar.gz",
+		"prefix/pre+fix/MozillaFirebird:i686-linux-gtk2+xft.tar.gz",
+		"prefix/pre+fix/prefix+1/key2",
+		"prefix/prefix+1/key3",
 	)
-	bl := NewBucketLister("bucket", "/prefix/", deliverytools.AWSSession)
+	for _, obj := range objects {
+		obj.Size = 2048
+	}
+	bl := NewBucketLister("bucket", "/prefix/", newMemStorage(objects...))
 
 	assert.Equal(t, bl.basePrefix, "prefix/")
 
@@ -76,5 +54,270 @@ func TestBucketPrefix(t *testing.T) {
 	err = json.Unmarshal(recorder.Body.Bytes(), res)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "prefix+1/", res.Prefixes[0])
+	assert.Contains(t, res.Prefixes, "prefix+1/")
+}
+
+func TestBucketListerServesStale(t *testing.T) {
+	storage := newMemStorage(memObjects("dir/key1")...)
+	bl := NewBucketLister("bucket", "/", storage)
+	bl.Cache = NewListingCache(10)
+	bl.CacheTTL = -time.Second
+	bl.Breaker = NewCircuitBreaker("bucket", 1, time.Minute)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dir/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Warning"))
+
+	storage.err = errors.New("SlowDown")
+
+	recorder = httptest.NewRecorder()
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "key1")
+	assert.Contains(t, recorder.Header().Get("Warning"), "110")
+	assert.Equal(t, "max-age=30", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, breakerOpen, bl.Breaker.State())
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/uncached/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 503, recorder.Code)
+}
+
+func TestBucketListerConditionalGet(t *testing.T) {
+	modified := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	objects := memObjects("dir/key1")
+	objects[0].LastModified = modified
+	bl := NewBucketLister("bucket", "/", newMemStorage(objects...))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dir/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	htmlETag := recorder.Header().Get("ETag")
+	assert.NotEmpty(t, htmlETag)
+	assert.Equal(t, "Sat, 02 Jan 2016 03:04:05 GMT", recorder.Header().Get("Last-Modified"))
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	jsonETag := recorder.Header().Get("ETag")
+	assert.NotEqual(t, htmlETag, jsonETag, "representations should have distinct etags")
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("If-None-Match", `"other", `+jsonETag)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 304, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+	assert.Equal(t, jsonETag, recorder.Header().Get("ETag"))
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("Accept", "text/html")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code, "json etag should not match html")
+
+	recorder = httptest.NewRecorder()
+	req.Header.Del("If-None-Match")
+	req.Header.Set("If-Modified-Since", "Sat, 02 Jan 2016 03:04:05 GMT")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 304, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("If-Modified-Since", "Sat, 02 Jan 2016 03:04:04 GMT")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("HEAD", "/dir/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+	assert.NotEqual(t, "0", recorder.Header().Get("Content-Length"))
+	assert.Equal(t, htmlETag, recorder.Header().Get("ETag"))
+}
+
+func testObjects(n int) []*Object {
+	now := time.Now()
+	objects := make([]*Object, n)
+	for i := range objects {
+		objects[i] = &Object{
+			Key:          fmt.Sprintf("dir/file%03d", i),
+			LastModified: now,
+			Size:         int64(i),
+		}
+	}
+	return objects
+}
+
+func TestBucketListerPagination(t *testing.T) {
+	bl := NewBucketLister("bucket", "/", newMemStorage(testObjects(5)...))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dir/?limit=2", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	res := new(PrefixListing)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.Len(t, res.Files, 2)
+	assert.Equal(t, "file000", res.Files[0].Name)
+	assert.Equal(t, "dir/file001", res.Next)
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/dir/?limit=2&after=dir/file003", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	res = new(PrefixListing)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.Len(t, res.Files, 1)
+	assert.Equal(t, "file004", res.Files[0].Name)
+	assert.Empty(t, res.Next)
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/dir/?limit=2", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Contains(t, recorder.Body.String(), `href="?after=dir%2Ffile001&amp;limit=2"`)
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/dir/?limit=abc", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 400, recorder.Code)
+}
+
+func TestBucketListerStreaming(t *testing.T) {
+	storage := newMemStorage(testObjects(5)...)
+	storage.pageSize = 2
+	bl := NewBucketLister("bucket", "/", storage)
+	bl.Cache = NewListingCache(10)
+	bl.CacheTTL = time.Minute
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dir/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.True(t, recorder.Flushed)
+	assert.Empty(t, recorder.Header().Get("ETag"), "streamed listings have no validators")
+	for i := 0; i < 5; i++ {
+		assert.Contains(t, recorder.Body.String(), fmt.Sprintf("file%03d", i))
+	}
+	assert.Contains(t, recorder.Body.String(), "</html>")
+
+	recorder = httptest.NewRecorder()
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.False(t, recorder.Flushed, "cached listings are not streamed")
+	assert.NotEmpty(t, recorder.Header().Get("ETag"))
+	assert.Contains(t, recorder.Body.String(), "file004")
+}
+
+func TestBucketListerStreamingVersionOrder(t *testing.T) {
+	storage := newMemStorage(memObjects(
+		"releases/10.0/a",
+		"releases/45.0/a",
+		"releases/45.0b1/a",
+		"releases/9.0/a",
+		"releases/notes.txt",
+	)...)
+	storage.pageSize = 2
+	bl := NewBucketLister("bucket", "/", storage)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/releases/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.True(t, recorder.Flushed)
+
+	body := recorder.Body.String()
+	last := -1
+	for _, dir := range []string{">9.0/<", ">10.0/<", ">45.0b1/<", ">45.0/<"} {
+		i := strings.Index(body, dir)
+		assert.True(t, i > last, "%s is streamed in version order", dir)
+		assert.Equal(t, i, strings.LastIndex(body, dir), "%s is streamed once", dir)
+		last = i
+	}
+	assert.Contains(t, body, "notes.txt")
+}
+
+func TestBucketListerStreamingMatchesCached(t *testing.T) {
+	storage := newMemStorage(memObjects(
+		"releases/10.0/a",
+		"releases/SHA512SUMS",
+		"releases/9.0/a",
+		"releases/notes.txt",
+		"releases/zz/a",
+	)...)
+	storage.pageSize = 2
+	bl := NewBucketLister("bucket", "/", storage)
+	bl.Cache = NewListingCache(10)
+	bl.CacheTTL = time.Minute
+
+	req, err := http.NewRequest("GET", "/releases/", nil)
+	assert.NoError(t, err)
+	streamed := httptest.NewRecorder()
+	bl.ServeHTTP(streamed, req)
+	assert.True(t, streamed.Flushed)
+
+	cached := httptest.NewRecorder()
+	bl.ServeHTTP(cached, req)
+	assert.False(t, cached.Flushed)
+
+	body := streamed.Body.String()
+	assert.True(t, strings.Index(body, ">zz/<") < strings.Index(body, ">SHA512SUMS<"), "directories are listed before files")
+	assert.Equal(t, cached.Body.String(), body)
+}
+
+// failingWriter is a client which has gone away
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+func TestBucketListerStreamingClientGone(t *testing.T) {
+	storage := newMemStorage(testObjects(5)...)
+	storage.pageSize = 2
+	bl := NewBucketLister("bucket", "/", storage)
+	bl.Cache = NewListingCache(10)
+	bl.CacheTTL = time.Minute
+
+	req, err := http.NewRequest("GET", "/dir/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(failingWriter{httptest.NewRecorder()}, req)
+
+	listing, _, err := bl.listPrefix("/dir/", "dir/", nil)
+	assert.NoError(t, err, "the listing is fetched for other requests")
+	assert.Len(t, listing.Files, 5)
+	assert.Equal(t, 3, storage.lists, "the listing is served from the cache")
+}
+
+func TestBucketListerVersionOrder(t *testing.T) {
+	storage := newMemStorage(memObjects(
+		"releases/10.0/a",
+		"releases/45.0/a",
+		"releases/45.0b1/a",
+		"releases/9.0/a",
+	)...)
+	bl := NewBucketLister("bucket", "/", storage)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/releases/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	res := new(PrefixListing)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.Equal(t, []string{"9.0/", "10.0/", "45.0b1/", "45.0/"}, res.Prefixes)
 }
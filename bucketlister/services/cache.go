@@ -0,0 +1,136 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/mozilla-services/product-delivery-tools/metrics"
+)
+
+// ListingCache is an in-memory LRU cache of PrefixListings keyed by bucket
+// and prefix
+//
+// Concurrent misses for the same key are coalesced into a single fetch.
+type ListingCache struct {
+	maxEntries int
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*cacheCall
+}
+
+type cacheEntry struct {
+	key     string
+	listing *PrefixListing
+	expires time.Time
+}
+
+type cacheCall struct {
+	wg      sync.WaitGroup
+	listing *PrefixListing
+	err     error
+}
+
+// NewListingCache returns a *ListingCache holding at most maxEntries listings
+func NewListingCache(maxEntries int) *ListingCache {
+	return &ListingCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		inflight:   make(map[string]*cacheCall),
+	}
+}
+
+func cacheKey(bucket, prefix string) string {
+	return bucket + "/" + prefix
+}
+
+// Get returns the listing for bucket and prefix
+//
+// If the cached listing is missing or older than ttl, fetch is called to
+// refresh it. Only one fetch per key runs at a time; other callers wait for
+// its result.
+func (c *ListingCache) Get(bucket, prefix string, ttl time.Duration, fetch func() (*PrefixListing, error)) (*PrefixListing, error) {
+	key := cacheKey(bucket, prefix)
+	tags := []string{"bucket:" + bucket}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			go metrics.Metric.Count("listing_cache.hit", 1, tags)
+			return entry.listing, nil
+		}
+	}
+
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		go metrics.Metric.Count("listing_cache.coalesced", 1, tags)
+		call.wg.Wait()
+		return call.listing, call.err
+	}
+
+	call := new(cacheCall)
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	go metrics.Metric.Count("listing_cache.miss", 1, tags)
+	call.listing, call.err = fetch()
+
+	c.mu.Lock()
+	if call.err == nil {
+		c.add(key, call.listing, time.Now().Add(ttl))
+	}
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	call.wg.Done()
+
+	return call.listing, call.err
+}
+
+// Stale returns the last listing fetched for bucket and prefix, even if it
+// has expired
+func (c *ListingCache) Stale(bucket, prefix string) *PrefixListing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[cacheKey(bucket, prefix)]; ok {
+		return elem.Value.(*cacheEntry).listing
+	}
+	return nil
+}
+
+// add stores listing at key, c.mu must be held
+func (c *ListingCache) add(key string, listing *PrefixListing, expires time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.listing = listing
+		entry.expires = expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:     key,
+		listing: listing,
+		expires: expires,
+	})
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of cached listings
+func (c *ListingCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
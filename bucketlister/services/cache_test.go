@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingCacheGet(t *testing.T) {
+	cache := NewListingCache(2)
+	calls := 0
+	fetch := func() (*PrefixListing, error) {
+		calls++
+		return &PrefixListing{Prefixes: []string{"a/"}}, nil
+	}
+
+	listing, err := cache.Get("bucket", "prefix/", time.Minute, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/"}, listing.Prefixes)
+
+	_, err = cache.Get("bucket", "prefix/", time.Minute, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls, "second get should be a hit")
+
+	_, err = cache.Get("other", "prefix/", time.Minute, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "keys include the bucket")
+
+	_, err = cache.Get("bucket", "expired/", -time.Second, fetch)
+	assert.NoError(t, err)
+	_, err = cache.Get("bucket", "expired/", -time.Second, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls, "expired entries should be refetched")
+	assert.Equal(t, 2, cache.Len(), "cache should be bounded by maxEntries")
+
+	_, err = cache.Get("bucket", "error/", time.Minute, func() (*PrefixListing, error) {
+		return nil, errors.New("boom")
+	})
+	assert.Error(t, err)
+	_, err = cache.Get("bucket", "error/", time.Minute, fetch)
+	assert.NoError(t, err, "errors should not be cached")
+}
+
+func TestListingCacheCoalesce(t *testing.T) {
+	cache := NewListingCache(10)
+	var calls int32
+	release := make(chan struct{})
+	fetch := func() (*PrefixListing, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return new(PrefixListing), nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.Get("bucket", "prefix/", time.Minute, fetch)
+			assert.NoError(t, err)
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
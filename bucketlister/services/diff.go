@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDiffMaxObjects is the default limit of files in each directory of
+// a diff
+const DefaultDiffMaxObjects = 10000
+
+// DirDiff compares the recursive contents of two directories
+//
+// The directories are given by ?from= and ?to= and may be served by
+// different listers. Files are matched by their path relative to each
+// directory and are changed if their size or ETag differ.
+type DirDiff struct {
+	Root *BucketLister
+
+	// MaxObjects is the largest number of files walked in each directory,
+	// larger directories are rejected with diffTooLargeError
+	MaxObjects int
+}
+
+// NewDirDiff returns a *DirDiff comparing directories of the listers mounted
+// on root
+func NewDirDiff(root *BucketLister) *DirDiff {
+	return &DirDiff{Root: root, MaxObjects: DefaultDiffMaxObjects}
+}
+
+// diffTooLargeError is returned when a directory exceeds DirDiff.MaxObjects
+type diffTooLargeError string
+
+func (e diffTooLargeError) Error() string {
+	return string(e)
+}
+
+// diffFile is a file in one side of a diff
+type diffFile struct {
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// SizeString returns the size in the same format as listings
+func (d *diffFile) SizeString() string {
+	return (&File{Size: d.Size}).SizeString()
+}
+
+// diffEntry is a file that differs between the directories
+type diffEntry struct {
+	Path string    `json:"path"`
+	From *diffFile `json:"from,omitempty"`
+	To   *diffFile `json:"to,omitempty"`
+}
+
+// dirDiff is the result of comparing two directories
+type dirDiff struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Added   []*diffEntry `json:"added"`
+	Removed []*diffEntry `json:"removed"`
+	Changed []*diffEntry `json:"changed"`
+}
+
+// files returns the files below dirPath keyed by their relative path, or
+// diffTooLargeError if there are more than d.MaxObjects
+func (d *DirDiff) files(dirPath string) (map[string]*diffFile, error) {
+	files := make(map[string]*diffFile)
+	err := d.Root.listerFor(dirPath).walk(dirPath, func(p string, obj *Object) error {
+		if len(files) >= d.MaxObjects {
+			return diffTooLargeError(fmt.Sprintf("%s has more than %d objects", dirPath, d.MaxObjects))
+		}
+		files[strings.TrimPrefix(p, dirPath)] = &diffFile{
+			Size:         obj.Size,
+			ETag:         strings.Trim(obj.ETag, `"`),
+			LastModified: obj.LastModified.UTC(),
+		}
+		return nil
+	})
+	return files, err
+}
+
+func compareDirs(from, to map[string]*diffFile) (added, removed, changed []*diffEntry) {
+	added, removed, changed = []*diffEntry{}, []*diffEntry{}, []*diffEntry{}
+	for p, f := range from {
+		t, ok := to[p]
+		switch {
+		case !ok:
+			removed = append(removed, &diffEntry{Path: p, From: f})
+		case f.Size != t.Size || f.ETag != t.ETag:
+			changed = append(changed, &diffEntry{Path: p, From: f, To: t})
+		}
+	}
+	for p, t := range to {
+		if _, ok := from[p]; !ok {
+			added = append(added, &diffEntry{Path: p, To: t})
+		}
+	}
+
+	for _, entries := range [][]*diffEntry{added, removed, changed} {
+		sort.Sort(diffEntriesByPath(entries))
+	}
+	return added, removed, changed
+}
+
+type diffEntriesByPath []*diffEntry
+
+func (d diffEntriesByPath) Len() int { return len(d) }
+
+func (d diffEntriesByPath) Less(i, j int) bool { return d[i].Path < d[j].Path }
+
+func (d diffEntriesByPath) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+
+// diffDir returns the cleaned directory path p of the query parameter name
+func diffDir(p, name string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", invalidArgumentError(fmt.Sprintf("invalid %s %q, expected an absolute path", name, p))
+	}
+	p = path.Clean(p)
+	if p != "/" {
+		p += "/"
+	}
+	return p, nil
+}
+
+// ServeHTTP implements http.Handler
+func (d *DirDiff) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	from, err := diffDir(query.Get("from"), "from")
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	to, err := diffDir(query.Get("to"), "to")
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+
+	format, err := negotiateFormat(req)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if format != htmlFormat && format != jsonFormat {
+		writeError(w, req, invalidArgumentError(fmt.Sprintf("diff is not available as %s", format.Name)))
+		return
+	}
+
+	fromFiles, err := d.files(from)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	toFiles, err := d.files(to)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if len(fromFiles) == 0 && len(toFiles) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Not Found"))
+		return
+	}
+
+	diff := &dirDiff{From: from, To: to}
+	diff.Added, diff.Removed, diff.Changed = compareDirs(fromFiles, toFiles)
+
+	body := new(bytes.Buffer)
+	if format == jsonFormat {
+		err = json.NewEncoder(body).Encode(diff)
+	} else {
+		err = diffTemplate.Execute(body, diff)
+	}
+	if err != nil {
+		log.Printf("Error rendering diff err: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Internal Server Error."))
+		return
+	}
+
+	setExpiresIn(time.Minute, w)
+	setVary(req, w)
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	if req.Method == "HEAD" {
+		return
+	}
+	w.Write(body.Bytes())
+}
+
+// diffTemplate links directories and files the way listTemplate does
+var diffTemplate = template.Must(template.New("Diff").Funcs(template.FuncMap{
+	"fileEscape": s3Escaper.Replace,
+	"dirEscape":  urlEscaper.Replace,
+}).Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>Diff: {{.From}} {{.To}}</title>
+	</head>
+	<body>
+		<h1>Diff of <a href="{{dirEscape .From}}">{{.From}}</a> and <a href="{{dirEscape .To}}">{{.To}}</a></h1>
+		<table>
+			<tr>
+				<th>Change</th>
+				<th>Name</th>
+				<th>Size</th>
+				<th>Last Modified</th>
+			</tr>
+			{{range .Added}}
+			<tr>
+				<td>Added</td>
+				<td><a href="{{fileEscape $.To}}{{fileEscape .Path}}">{{.Path}}</a></td>
+				<td>{{.To.SizeString}}</td>
+				<td>{{.To.LastModified.Format "02-Jan-2006 15:04"}}</td>
+			</tr>
+			{{end}}
+			{{range .Removed}}
+			<tr>
+				<td>Removed</td>
+				<td><a href="{{fileEscape $.From}}{{fileEscape .Path}}">{{.Path}}</a></td>
+				<td>{{.From.SizeString}}</td>
+				<td>{{.From.LastModified.Format "02-Jan-2006 15:04"}}</td>
+			</tr>
+			{{end}}
+			{{range .Changed}}
+			<tr>
+				<td>Changed</td>
+				<td><a href="{{fileEscape $.To}}{{fileEscape .Path}}">{{.Path}}</a></td>
+				<td>{{.From.SizeString}} &rarr; {{.To.SizeString}}</td>
+				<td>{{.To.LastModified.Format "02-Jan-2006 15:04"}}</td>
+			</tr>
+			{{end}}
+		</table>
+	</body>
+</html>
+`))
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirDiff(t *testing.T) {
+	storage := bucketsStorage(map[string][]string{
+		"archive": {
+			"pub/firefox/bundles/build1/same.txt",
+		},
+		"firefox": {
+			"pub/firefox/candidates/build1/removed.txt",
+			"pub/firefox/candidates/build1/same.txt",
+			"pub/firefox/candidates/build1/sub/changed",
+			"pub/firefox/candidates/build2/added.txt",
+			"pub/firefox/candidates/build2/same.txt",
+			"pub/firefox/candidates/build2/sub/changed",
+		},
+	})
+	// memObjects derives etags from keys
+	for _, bucket := range storage {
+		for _, obj := range bucket.(*memStorage).objects {
+			obj.ETag = `"etag"`
+		}
+	}
+	changed, err := storage["firefox"].Stat("pub/firefox/candidates/build2/sub/changed")
+	assert.NoError(t, err)
+	changed.Size++
+
+	root := NewBucketLister("archive", "", storage["archive"])
+	firefox := NewBucketLister("firefox", "/pub/firefox/", storage["firefox"])
+	firefox.AddBucketLister(NewBucketLister("archive", "/pub/firefox/bundles/", storage["archive"]))
+	root.AddBucketLister(firefox)
+	differ := NewDirDiff(root)
+
+	diff := func(query string, accept string) (*httptest.ResponseRecorder, *dirDiff) {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/diff?"+query, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept", accept)
+		differ.ServeHTTP(recorder, req)
+
+		res := new(dirDiff)
+		if recorder.Code == http.StatusOK && accept == "application/json" {
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+		}
+		return recorder, res
+	}
+
+	recorder, res := diff("from=/pub/firefox/candidates/build1&to=/pub/firefox/candidates/build2/", "application/json")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "/pub/firefox/candidates/build1/", res.From)
+	if assert.Len(t, res.Added, 1) {
+		assert.Equal(t, "added.txt", res.Added[0].Path)
+	}
+	if assert.Len(t, res.Removed, 1) {
+		assert.Equal(t, "removed.txt", res.Removed[0].Path)
+	}
+	if assert.Len(t, res.Changed, 1) {
+		assert.Equal(t, "sub/changed", res.Changed[0].Path)
+	}
+
+	// directories in different buckets
+	recorder, res = diff("from=/pub/firefox/bundles/build1/&to=/pub/firefox/candidates/build2/", "application/json")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Len(t, res.Added, 2)
+	assert.Len(t, res.Removed, 0)
+	assert.Len(t, res.Changed, 1)
+
+	recorder, _ = diff("from=/pub/firefox/candidates/build1/&to=/pub/firefox/candidates/build2/", "text/html")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `<a href="/pub/firefox/candidates/build2/added.txt">added.txt</a>`)
+
+	recorder, _ = diff("from=build1&to=/pub/", "application/json")
+	assert.Equal(t, 400, recorder.Code)
+
+	recorder, _ = diff("from=/missing/&to=/missing2/", "application/json")
+	assert.Equal(t, 404, recorder.Code)
+}
+
+func TestDirDiffLimit(t *testing.T) {
+	storage := bucketsStorage(map[string][]string{
+		"archive": {
+			"pub/build1/a.txt",
+			"pub/build1/b.txt",
+			"pub/build2/a.txt",
+		},
+	})
+	differ := NewDirDiff(NewBucketLister("archive", "", storage["archive"]))
+	differ.MaxObjects = 2
+
+	diff := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/diff?"+query, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept", "application/json")
+		differ.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, 200, diff("from=/pub/build1/&to=/pub/build2/").Code)
+
+	recorder := diff("from=/&to=/pub/build2/")
+	assert.Equal(t, 413, recorder.Code)
+	res := new(errorResponse)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.Equal(t, "DiffTooLarge", res.Code)
+}
+
+func TestDirDiffEscaping(t *testing.T) {
+	storage := bucketsStorage(map[string][]string{
+		"archive": {
+			"pub/50.0+build1/same.txt",
+			"pub/50.0+build2/same.txt",
+			"pub/50.0+build2/a+b:c.txt",
+		},
+	})
+	for _, obj := range storage["archive"].(*memStorage).objects {
+		obj.ETag = `"etag"`
+	}
+	differ := NewDirDiff(NewBucketLister("archive", "", storage["archive"]))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/diff?from=/pub/50.0%2Bbuild1/&to=/pub/50.0%2Bbuild2/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "text/html")
+	differ.ServeHTTP(recorder, req)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `<a href="/pub/50.0%2Bbuild2/a%2Bb%3Ac.txt">a&#43;b:c.txt</a>`)
+	assert.Contains(t, recorder.Body.String(), `<a href="/pub/50.0&#43;build1/">`)
+}
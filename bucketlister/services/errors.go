@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// retryAfter is sent with responses to throttled or unavailable backends
+const retryAfter = 30 * time.Second
+
+// s3Error records an error and the S3 operation that caused it
+type s3Error struct {
+	Op     string
+	Bucket string
+	Key    string
+	Err    error
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("%s %s/%s err: %s", e.Op, e.Bucket, e.Key, e.Err)
+}
+
+// invalidArgumentError is returned for malformed request parameters
+type invalidArgumentError string
+
+func (e invalidArgumentError) Error() string {
+	return string(e)
+}
+
+// errorCode returns the S3 error code of err, if any
+func errorCode(err error) string {
+	if e, ok := err.(*s3Error); ok {
+		err = e.Err
+	}
+	if e, ok := err.(*storageError); ok {
+		return e.code
+	}
+	if err == ErrCircuitOpen {
+		return "CircuitOpen"
+	}
+	if _, ok := err.(invalidArgumentError); ok {
+		return "InvalidArgument"
+	}
+	if _, ok := err.(archiveTooLargeError); ok {
+		return "ArchiveTooLarge"
+	}
+	if _, ok := err.(diffTooLargeError); ok {
+		return "DiffTooLarge"
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		if isTimeout(awsErr) {
+			return request.ErrCodeResponseTimeout
+		}
+		return awsErr.Code()
+	}
+	return ""
+}
+
+func isTimeout(awsErr awserr.Error) bool {
+	if awsErr.Code() == request.ErrCodeResponseTimeout {
+		return true
+	}
+	netErr, ok := awsErr.OrigErr().(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// errorStatus returns the HTTP status that represents an S3 error code
+func errorStatus(code string) int {
+	switch code {
+	case "NotModified":
+		return http.StatusNotModified
+	case "PreconditionFailed":
+		return http.StatusPreconditionFailed
+	case "InvalidRange":
+		return http.StatusRequestedRangeNotSatisfiable
+	case "InvalidArgument":
+		return http.StatusBadRequest
+	case "ArchiveTooLarge", "DiffTooLarge":
+		return http.StatusRequestEntityTooLarge
+	case "NoSuchBucket", "NoSuchKey", "NotFound":
+		return http.StatusNotFound
+	case "AccessDenied", "AllAccessDisabled", "AccountProblem":
+		return http.StatusForbidden
+	case "SlowDown", "ServiceUnavailable", "Throttling", "RequestLimitExceeded", "CircuitOpen":
+		return http.StatusServiceUnavailable
+	case "RequestTimeout", request.ErrCodeResponseTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// isBackendFailure returns true if err indicates S3 itself is failing,
+// rather than the request being invalid
+func isBackendFailure(err error) bool {
+	return errorStatus(errorCode(err)) >= http.StatusInternalServerError
+}
+
+func logError(code string, status int, err error) {
+	if status == http.StatusNotModified {
+		return
+	}
+	log.Printf("Error code: %s, status: %d, err: %s", code, status, err)
+}
+
+type errorResponse struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeError logs err and writes the response matching its S3 error code
+func writeError(w http.ResponseWriter, req *http.Request, err error) {
+	code := errorCode(err)
+	status := errorStatus(code)
+	logError(code, status, err)
+
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	if status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+
+	setVary(req, w)
+	if format, _ := negotiateFormat(req); format == jsonFormat {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(&errorResponse{
+			Status:  status,
+			Code:    code,
+			Message: http.StatusText(status),
+		})
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status) + "."))
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorStatus(t *testing.T) {
+	cases := []struct {
+		Err    error
+		Status int
+	}{
+		{awserr.New("NoSuchBucket", "bucket does not exist", nil), 404},
+		{awserr.New("AccessDenied", "access denied", nil), 403},
+		{awserr.New("SlowDown", "slow down", nil), 503},
+		{awserr.New("RequestError", "send request failed", timeoutError{}), 504},
+		{&s3Error{Op: "listing", Bucket: "b", Err: ErrCircuitOpen}, 503},
+		{&s3Error{Op: "listing", Bucket: "b", Err: awserr.New("AccessDenied", "", nil)}, 403},
+		{&storageError{code: "NoSuchKey", message: "key does not exist"}, 404},
+		{errors.New("unknown"), 500},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Status, errorStatus(errorCode(c.Err)), c.Err.Error())
+	}
+}
+
+func TestBucketListerErrors(t *testing.T) {
+	storage := newMemStorage()
+	bl := NewBucketLister("bucket", "/", storage)
+
+	storage.err = &s3Error{Op: "listing", Bucket: "bucket", Err: awserr.New("SlowDown", "slow down", nil)}
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dir/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "30", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, "Service Unavailable.", recorder.Body.String())
+
+	storage.err = &s3Error{Op: "listing", Bucket: "bucket", Err: awserr.New("NoSuchBucket", "no bucket", nil)}
+	recorder = httptest.NewRecorder()
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 404, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	res := new(errorResponse)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.Equal(t, &errorResponse{Status: 404, Code: "NoSuchBucket", Message: "Not Found"}, res)
+}
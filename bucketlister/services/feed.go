@@ -0,0 +1,163 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mozilla-services/product-delivery-tools/mozversion"
+)
+
+// feedEntries is the number of entries in an Atom feed
+const feedEntries = 20
+
+// feedDirDepth limits how deep feedDirUpdated looks for files
+const feedDirDepth = 3
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Author  atomAuthor   `xml:"author"`
+	Link    atomLink     `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+
+	updated time.Time
+}
+
+// baseURL returns the scheme and host req was made to
+func baseURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+// listingFeed returns an Atom feed of the most recently modified files and
+// subdirectories of input.PrefixListing
+//
+// Subdirectories are dated by the newest file they contain, looking into
+// their newest subdirectory if they only contain directories.
+func (b *BucketLister) listingFeed(req *http.Request, input *listTemplateInput) *atomFeed {
+	base := baseURL(req)
+	entries := []*atomEntry{}
+
+	for _, file := range input.PrefixListing.Files {
+		if file.Base() == "." {
+			continue
+		}
+		href := base + input.PathEscaped() + file.BaseEscaped()
+		entries = append(entries, &atomEntry{
+			Title:   file.Base(),
+			ID:      href,
+			Link:    atomLink{Href: href},
+			updated: file.LastModified,
+		})
+	}
+
+	// Only the newest directories by version are considered, to bound the
+	// number of listings needed
+	dirs := append([]string{}, input.PrefixListing.Prefixes...)
+	sort.Sort(sort.Reverse(mozversion.Slice(dirs)))
+	if len(dirs) > feedEntries {
+		dirs = dirs[:feedEntries]
+	}
+	for _, dir := range dirs {
+		updated := b.feedDirUpdated(input.Path+dir, feedDirDepth)
+		if updated.IsZero() {
+			continue
+		}
+		href := base + input.PathURLEscaped() + Prefix(dir).URLEscaped()
+		entries = append(entries, &atomEntry{
+			Title:   dir,
+			ID:      href,
+			Link:    atomLink{Href: href},
+			updated: updated,
+		})
+	}
+
+	sort.Sort(atomEntriesByUpdated(entries))
+	if len(entries) > feedEntries {
+		entries = entries[:feedEntries]
+	}
+
+	feed := &atomFeed{
+		Title:   "Index of " + input.Path,
+		ID:      base + input.PathURLEscaped(),
+		Author:  atomAuthor{Name: req.Host},
+		Link:    atomLink{Href: base + input.PathURLEscaped(), Rel: "alternate"},
+		Entries: entries,
+	}
+
+	var updated time.Time
+	for _, e := range entries {
+		e.Updated = e.updated.UTC().Format(time.RFC3339)
+		if e.updated.After(updated) {
+			updated = e.updated
+		}
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	return feed
+}
+
+// feedDirUpdated returns the newest LastModified below reqPath, or a zero
+// time if it cannot be determined
+func (b *BucketLister) feedDirUpdated(reqPath string, depth int) time.Time {
+	lister := b.listerFor(reqPath)
+	listing, _, err := lister.listPrefix(reqPath, lister.keyPrefix(reqPath), nil)
+	if err != nil {
+		return time.Time{}
+	}
+
+	if updated := listing.LastModified(); !updated.IsZero() || depth <= 1 || len(listing.Prefixes) == 0 {
+		return updated
+	}
+
+	newest := listing.Prefixes[0]
+	for _, p := range listing.Prefixes[1:] {
+		if mozversion.Less(newest, p) {
+			newest = p
+		}
+	}
+	return b.feedDirUpdated(reqPath+newest, depth-1)
+}
+
+// feedETag returns a hash of the entries of feed
+func feedETag(feed *atomFeed) string {
+	h := sha1.New()
+	for _, e := range feed.Entries {
+		fmt.Fprintf(h, "%s\x00%s\n", e.ID, e.Updated)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type atomEntriesByUpdated []*atomEntry
+
+func (a atomEntriesByUpdated) Len() int { return len(a) }
+
+func (a atomEntriesByUpdated) Less(i, j int) bool { return a[i].updated.After(a[j].updated) }
+
+func (a atomEntriesByUpdated) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketListerFeed(t *testing.T) {
+	old := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	bl := NewBucketLister("bucket", "/", newMemStorage(
+		&Object{Key: "latest/old+file.txt", LastModified: old, Size: 1},
+		&Object{Key: "latest/sub:dir/new", LastModified: recent, Size: 1},
+	))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://archive.example.com/latest/?format=atom", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "application/atom+xml", recorder.Header().Get("Content-Type"))
+	assert.NotEmpty(t, recorder.Header().Get("ETag"))
+
+	feed := new(atomFeed)
+	assert.NoError(t, xml.Unmarshal(recorder.Body.Bytes(), feed))
+	assert.Equal(t, "2016-01-02T00:00:00Z", feed.Updated)
+	assert.Len(t, feed.Entries, 2)
+	assert.Equal(t, "sub:dir/", feed.Entries[0].Title)
+	assert.Equal(t, "http://archive.example.com/latest/sub%3Adir/", feed.Entries[0].Link.Href)
+	assert.Equal(t, "http://archive.example.com/latest/old%2Bfile.txt", feed.Entries[1].Link.Href)
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://archive.example.com/latest/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/atom+xml")
+	bl.ServeHTTP(recorder, req)
+	assert.True(t, strings.HasPrefix(recorder.Body.String(), "<?xml"))
+}
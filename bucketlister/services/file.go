@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// File modes of a BucketLister
+//
+// Any other FileMode is a CDN base URL which object requests are redirected
+// to.
+const (
+	// FileProxy copies objects from storage, this is the default
+	FileProxy = "proxy"
+
+	// FilePresign redirects to a presigned S3 URL
+	FilePresign = "presign"
+)
+
+// presignExpiresIn is how long presigned URLs are valid for
+const presignExpiresIn = 15 * time.Minute
+
+// ValidFileMode returns an error if mode is not a file mode
+func ValidFileMode(mode string) error {
+	switch mode {
+	case "", FileProxy, FilePresign:
+		return nil
+	}
+	u, err := url.Parse(mode)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid file mode %q, expected %s, %s or a CDN base URL", mode, FileProxy, FilePresign)
+	}
+	return nil
+}
+
+// serveFile serves the request if its path is an object
+//
+// Paths ending with a slash are always directories. Otherwise the object is
+// proxied or redirected to according to b.FileMode, and false is returned
+// if it does not exist. FilePresign falls back to proxying if b.Storage is
+// not a Presigner.
+func (b *BucketLister) serveFile(w http.ResponseWriter, req *http.Request) bool {
+	reqPath := req.URL.Path
+	if strings.HasSuffix(reqPath, "/") || reqPath+"/" == b.mountedAt {
+		return false
+	}
+
+	key := b.basePrefix + strings.TrimPrefix(reqPath, b.mountedAt)
+	presigner, canPresign := b.Storage.(Presigner)
+
+	if b.FileMode == "" || b.FileMode == FileProxy || (b.FileMode == FilePresign && !canPresign) {
+		err := proxyObject(w, req, b.Storage, key)
+		if err == nil {
+			return true
+		}
+		if errorStatus(errorCode(err)) == http.StatusNotFound {
+			return false
+		}
+		writeError(w, req, err)
+		return true
+	}
+
+	if _, err := b.Storage.Stat(key); err != nil {
+		if errorStatus(errorCode(err)) == http.StatusNotFound {
+			return false
+		}
+		writeError(w, req, err)
+		return true
+	}
+
+	if b.FileMode == FilePresign {
+		location, err := presigner.Presign(key, presignExpiresIn)
+		if err != nil {
+			writeError(w, req, err)
+			return true
+		}
+		// expire well before the signature does
+		setExpiresIn(presignExpiresIn/3, w)
+		http.Redirect(w, req, location, http.StatusFound)
+		return true
+	}
+
+	// escaped like listing links, S3 and CDNs read "+" as a space
+	location := strings.TrimSuffix(b.FileMode, "/") + s3Escaper.Replace((&url.URL{Path: reqPath}).EscapedPath())
+	setExpiresIn(15*time.Minute, w)
+	http.Redirect(w, req, location, http.StatusFound)
+	return true
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// presignStorage presigns URLs of a fake firefox bucket
+type presignStorage struct {
+	*memStorage
+}
+
+func (p *presignStorage) Presign(key string, expires time.Duration) (string, error) {
+	return "https://firefox.s3.amazonaws.com/" + key + "?signed", nil
+}
+
+func TestBucketListerFile(t *testing.T) {
+	objects := memObjects("pub/firefox/a.txt", "pub/firefox/dir/sub/b.txt", "pub/firefox/50.0+build1/a b.txt")
+	objects[0].ContentType = "text/plain"
+	storage := newMemStorage(objects...)
+	bl := NewBucketLister("firefox", "/pub/firefox/", storage)
+	get := func(p string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", p, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Range", "bytes=1-2")
+		bl.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := get("/pub/firefox/a.txt")
+	assert.Equal(t, 206, recorder.Code)
+	assert.Equal(t, "ub", recorder.Body.String())
+	assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `"pub/firefox/a.txt"`, recorder.Header().Get("ETag"))
+	assert.Equal(t, "2", recorder.Header().Get("Content-Length"))
+	assert.Equal(t, "bytes 1-2/17", recorder.Header().Get("Content-Range"))
+
+	// directories without a trailing slash are still listed
+	recorder = get("/pub/firefox/dir")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "sub/")
+
+	bl.FileMode = FilePresign
+	recorder = get("/pub/firefox/a.txt")
+	assert.Equal(t, 206, recorder.Code, "storage which cannot presign is proxied")
+
+	bl.Storage = &presignStorage{storage}
+	recorder = get("/pub/firefox/a.txt")
+	assert.Equal(t, 302, recorder.Code)
+	assert.Equal(t, "https://firefox.s3.amazonaws.com/pub/firefox/a.txt?signed", recorder.Header().Get("Location"))
+
+	bl.FileMode = "https://cdn.example.com/"
+	recorder = get("/pub/firefox/a.txt")
+	assert.Equal(t, 302, recorder.Code)
+	assert.Equal(t, "https://cdn.example.com/pub/firefox/a.txt", recorder.Header().Get("Location"))
+
+	recorder = get("/pub/firefox/50.0+build1/a%20b.txt")
+	assert.Equal(t, 302, recorder.Code)
+	assert.Equal(t, "https://cdn.example.com/pub/firefox/50.0%2Bbuild1/a%20b.txt", recorder.Header().Get("Location"))
+
+	recorder = get("/pub/firefox/missing.txt")
+	assert.Equal(t, 404, recorder.Code)
+
+	assert.NoError(t, ValidFileMode("https://cdn.example.com"))
+	assert.Error(t, ValidFileMode("cdn.example.com"))
+}
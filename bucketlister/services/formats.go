@@ -0,0 +1,52 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// writeTextListing writes one absolute URL per line, suitable for wget -i
+func writeTextListing(w io.Writer, req *http.Request, input *listTemplateInput) error {
+	base := baseURL(req)
+	for _, dir := range input.PrefixListing.PrefixStructs() {
+		if _, err := fmt.Fprintln(w, base+input.PathURLEscaped()+dir.URLEscaped()); err != nil {
+			return err
+		}
+	}
+	for _, file := range input.PrefixListing.Files {
+		if file.Base() == "." {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, base+input.PathEscaped()+file.BaseEscaped()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSVListing writes a name, size, last_modified row per entry
+//
+// Directories have a trailing slash and no size or modification time.
+func writeCSVListing(w io.Writer, input *listTemplateInput) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"name", "size", "last_modified"})
+	for _, dir := range input.PrefixListing.Prefixes {
+		out.Write([]string{dir, "", ""})
+	}
+	for _, file := range input.PrefixListing.Files {
+		if file.Base() == "." {
+			continue
+		}
+		out.Write([]string{
+			file.Base(),
+			strconv.FormatInt(file.Size, 10),
+			file.LastModified.UTC().Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -3,32 +3,35 @@ package services
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-// variable for swapping in testing
-var listObjects = func(svc *s3.S3, bucket, prefix string) (objects []*s3.Object, prefixes []*s3.CommonPrefix, err error) {
-	listParams := &s3.ListObjectsInput{
-		Bucket:    aws.String(bucket),
-		Delimiter: aws.String("/"),
-		Prefix:    aws.String(prefix),
-	}
-	for {
-		res, err := svc.ListObjects(listParams)
-		if err != nil {
-			return nil, nil, fmt.Errorf("listing %s/%s err: %s", bucket, prefix, err)
-		}
-		prefixes = append(prefixes, res.CommonPrefixes...)
-		objects = append(objects, res.Contents...)
-		if (res.IsTruncated != nil && !*res.IsTruncated) || res.NextMarker == nil {
-			break
+// maxPageLimit is the largest page S3 will return
+const maxPageLimit = 1000
+
+// parsePagination returns the limit and after query parameters
+//
+// limit is 0 if the listing is not paginated.
+func parsePagination(req *http.Request) (limit int64, after string, err error) {
+	query := req.URL.Query()
+	after = query.Get("after")
+
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || limit < 1 {
+			return 0, "", invalidArgumentError(fmt.Sprintf("invalid limit %q", l))
 		}
-		listParams.Marker = aws.String(*res.NextMarker)
 	}
-	return
+
+	if after != "" && limit == 0 {
+		limit = maxPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, after, nil
 }
 
 func setExpiresIn(d time.Duration, w http.ResponseWriter) {
@@ -37,3 +40,46 @@ func setExpiresIn(d time.Duration, w http.ResponseWriter) {
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%.0f", d.Seconds()))
 	w.Header().Set("Expires", expiresAt.Format(http.TimeFormat))
 }
+
+func setValidators(etag string, lastModified time.Time, w http.ResponseWriter) {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified returns true if req's conditional headers match etag or
+// lastModified
+//
+// If-None-Match takes precedence over If-Modified-Since.
+func notModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	ims := req.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(t)
+}
+
+// etagMatches returns true if an If-None-Match header matches etag, using the
+// weak comparison
+func etagMatches(inm, etag string) bool {
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mozilla-services/product-delivery-tools/mozversion"
+)
+
+// latestExpiresIn is the max-age of latest release redirects and lookups
+const latestExpiresIn = 5 * time.Minute
+
+// latestRe matches /pub/<product>/releases/latest[-<channel>]/<rest>
+var latestRe = regexp.MustCompile(`^(.*/([^/]+)/releases/)(latest(?:-(release|beta|esr|devedition))?)(/.*)?$`)
+
+// latestJSONRe matches /pub/<product>/releases/latest.json
+var latestJSONRe = regexp.MustCompile(`^(.*/([^/]+)/releases/)(latest\.json)$`)
+
+var releaseVersionRe = regexp.MustCompile(`^\d+(\.\d+)+$`)
+var betaVersionRe = regexp.MustCompile(`^\d+(\.\d+)+b\d+$`)
+var esrVersionRe = regexp.MustCompile(`^\d+(\.\d+)+esr$`)
+
+// ReleaseChannel returns the channel of a release directory name, or "" if
+// dir is not a version
+//
+// Developer Edition is published as betas of the devedition product.
+func ReleaseChannel(product, dir string) string {
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case releaseVersionRe.MatchString(dir):
+		return "release"
+	case esrVersionRe.MatchString(dir):
+		return "esr"
+	case betaVersionRe.MatchString(dir):
+		if product == "devedition" {
+			return "devedition"
+		}
+		return "beta"
+	}
+	return ""
+}
+
+// LatestReleases returns the newest version directory of each channel in a
+// listing of pub/<product>/releases/
+func LatestReleases(product string, listing *PrefixListing) map[string]string {
+	latest := make(map[string]string)
+	for _, p := range listing.Prefixes {
+		dir := strings.TrimSuffix(p, "/")
+		channel := ReleaseChannel(product, dir)
+		if channel == "" {
+			continue
+		}
+		if cur, ok := latest[channel]; !ok || mozversion.Less(cur, dir) {
+			latest[channel] = dir
+		}
+	}
+	return latest
+}
+
+// serveLatest handles latest release lookups and redirects
+//
+// It returns false if req is not for a latest release path, or if the path
+// exists in the bucket, so that real latest directories are listed as usual.
+func (b *BucketLister) serveLatest(w http.ResponseWriter, req *http.Request) bool {
+	var releasesPath, product, name, channel, rest string
+	if m := latestJSONRe.FindStringSubmatch(req.URL.Path); m != nil {
+		releasesPath, product, name = m[1], m[2], m[3]
+	} else if m := latestRe.FindStringSubmatch(req.URL.Path); m != nil {
+		releasesPath, product, name, channel, rest = m[1], m[2], m[3], m[4], m[5]
+		if channel == "" {
+			channel = "release"
+		}
+	} else {
+		return false
+	}
+
+	if !strings.HasPrefix(releasesPath, b.mountedAt) {
+		return false
+	}
+
+	listing, _, err := b.listPrefix(releasesPath, b.keyPrefix(releasesPath), nil)
+	if err != nil {
+		writeError(w, req, err)
+		return true
+	}
+	if listing.HasPrefix(name+"/") || listing.HasFile(name) != nil {
+		return false
+	}
+	latest := LatestReleases(product, listing)
+
+	if channel == "" {
+		setExpiresIn(latestExpiresIn, w)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(latest); err != nil {
+			log.Printf("Error encoding JSON err: %s", err)
+		}
+		return true
+	}
+
+	version, ok := latest[channel]
+	if !ok {
+		writeError(w, req, &storageError{code: "NoSuchKey", message: "no " + channel + " release in " + releasesPath})
+		return true
+	}
+
+	target := releasesPath + version + "/" + strings.TrimPrefix(rest, "/")
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	setExpiresIn(latestExpiresIn, w)
+	http.Redirect(w, req, target, http.StatusFound)
+	return true
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func releasesStorage(dirs ...string) *memStorage {
+	keys := make([]string, len(dirs))
+	for i, dir := range dirs {
+		keys[i] = "pub/firefox/releases/" + dir + "README.txt"
+	}
+	return newMemStorage(memObjects(keys...)...)
+}
+
+func TestLatestReleases(t *testing.T) {
+	listing := &PrefixListing{
+		Prefixes: []string{"9.0/", "10.0/", "10.0b6/", "11.0b1/", "10.0esr/", "10.0.2esr/", "latest/", "partners/"},
+	}
+	assert.Equal(t, map[string]string{
+		"release": "10.0",
+		"beta":    "11.0b1",
+		"esr":     "10.0.2esr",
+	}, LatestReleases("firefox", listing))
+
+	assert.Equal(t, map[string]string{
+		"devedition": "11.0b1",
+	}, LatestReleases("devedition", &PrefixListing{Prefixes: []string{"10.0b6/", "11.0b1/"}}))
+}
+
+func TestBucketListerLatest(t *testing.T) {
+	bl := NewBucketLister("bucket", "/pub/firefox/", releasesStorage("9.0/", "10.0/", "11.0b1/", "10.0esr/"))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/pub/firefox/releases/latest.json", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	res := map[string]string{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.Equal(t, "10.0", res["release"])
+	assert.Equal(t, "11.0b1", res["beta"])
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/pub/firefox/releases/latest/linux-x86_64/en-US/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 302, recorder.Code)
+	assert.Equal(t, "/pub/firefox/releases/10.0/linux-x86_64/en-US/", recorder.Header().Get("Location"))
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/pub/firefox/releases/latest-esr?sort=size", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 302, recorder.Code)
+	assert.Equal(t, "/pub/firefox/releases/10.0esr/?sort=size", recorder.Header().Get("Location"))
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/pub/firefox/releases/latest-devedition/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 404, recorder.Code)
+	errRes := new(errorResponse)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), errRes))
+	assert.Equal(t, "NoSuchKey", errRes.Code)
+}
+
+func TestBucketListerLatestRealDirectory(t *testing.T) {
+	bl := NewBucketLister("bucket", "/pub/firefox/", releasesStorage("10.0/", "11.0b1/", "latest/"))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/pub/firefox/releases/latest/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code, "existing latest directories are listed")
+	res := new(PrefixListing)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.NotNil(t, res.HasFile("README.txt"))
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/pub/firefox/releases/latest-beta/", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 302, recorder.Code)
+	assert.Equal(t, "/pub/firefox/releases/11.0b1/", recorder.Header().Get("Location"))
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mozilla-services/product-delivery-tools/mozversion"
+)
+
+// listOptions are the sorting and filtering query parameters of a listing
+//
+// They mirror Apache mod_autoindex: ?sort=name|size|modified,
+// ?order=asc|desc and ?pattern=<glob>.
+type listOptions struct {
+	Sort    string
+	Order   string
+	Pattern string
+}
+
+func parseListOptions(req *http.Request) (*listOptions, error) {
+	query := req.URL.Query()
+	opts := &listOptions{
+		Sort:    query.Get("sort"),
+		Order:   query.Get("order"),
+		Pattern: query.Get("pattern"),
+	}
+
+	switch opts.Sort {
+	case "", "name", "size", "modified":
+	default:
+		return nil, invalidArgumentError(fmt.Sprintf("invalid sort %q", opts.Sort))
+	}
+
+	switch opts.Order {
+	case "", "asc", "desc":
+	default:
+		return nil, invalidArgumentError(fmt.Sprintf("invalid order %q", opts.Order))
+	}
+
+	if _, err := path.Match(opts.Pattern, ""); err != nil {
+		return nil, invalidArgumentError(fmt.Sprintf("invalid pattern %q", opts.Pattern))
+	}
+
+	return opts, nil
+}
+
+// IsDefault returns true if opts leave a listing unchanged
+func (o *listOptions) IsDefault() bool {
+	return o.Sort == "" && o.Order == "" && o.Pattern == ""
+}
+
+func (o *listOptions) descending() bool {
+	return o.Order == "desc"
+}
+
+// Apply returns a filtered and sorted copy of listing
+//
+// Prefixes have no size or modification time, so they are always ordered
+// by version.
+func (o *listOptions) Apply(listing *PrefixListing) *PrefixListing {
+	if o.IsDefault() {
+		return listing
+	}
+
+	res := &PrefixListing{
+		Prefixes: make([]string, 0, len(listing.Prefixes)),
+		Files:    make([]*File, 0, len(listing.Files)),
+		Next:     listing.Next,
+	}
+
+	for _, p := range listing.Prefixes {
+		if o.match(strings.TrimSuffix(p, "/")) {
+			res.Prefixes = append(res.Prefixes, p)
+		}
+	}
+	for _, f := range listing.Files {
+		if o.match(f.Base()) {
+			res.Files = append(res.Files, f)
+		}
+	}
+
+	if o.descending() {
+		sort.Sort(sort.Reverse(mozversion.Slice(res.Prefixes)))
+	}
+
+	var less func(a, b *File) bool
+	switch o.Sort {
+	case "size":
+		less = func(a, b *File) bool { return a.Size < b.Size }
+	case "modified":
+		less = func(a, b *File) bool { return a.LastModified.Before(b.LastModified) }
+	default:
+		less = func(a, b *File) bool { return a.Name < b.Name }
+	}
+	files := &fileSorter{files: res.Files, less: less}
+	if o.descending() {
+		sort.Stable(sort.Reverse(files))
+	} else {
+		sort.Stable(files)
+	}
+
+	return res
+}
+
+func (o *listOptions) match(name string) bool {
+	if o.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(o.Pattern, name)
+	return ok
+}
+
+// Values returns opts as query parameters
+func (o *listOptions) Values() url.Values {
+	values := url.Values{}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	if o.Order != "" {
+		values.Set("order", o.Order)
+	}
+	if o.Pattern != "" {
+		values.Set("pattern", o.Pattern)
+	}
+	return values
+}
+
+// SortValues returns query parameters which sort by column, reversing the
+// order if the listing is already sorted by column
+func (o *listOptions) SortValues(column string) url.Values {
+	values := o.Values()
+	values.Set("sort", column)
+	values.Del("order")
+
+	current := o.Sort
+	if current == "" {
+		current = "name"
+	}
+	if current == column && !o.descending() {
+		values.Set("order", "desc")
+	}
+	return values
+}
+
+type fileSorter struct {
+	files []*File
+	less  func(a, b *File) bool
+}
+
+func (f *fileSorter) Len() int { return len(f.files) }
+
+func (f *fileSorter) Less(i, j int) bool { return f.less(f.files[i], f.files[j]) }
+
+func (f *fileSorter) Swap(i, j int) { f.files[i], f.files[j] = f.files[j], f.files[i] }
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testListing() *PrefixListing {
+	now := time.Now()
+	return &PrefixListing{
+		Prefixes: []string{"a.dmg/", "b/", "c/"},
+		Files: []*File{
+			&File{Name: "firefox.dmg", Size: 30, LastModified: now.Add(-time.Hour)},
+			&File{Name: "firefox.exe", Size: 10, LastModified: now},
+			&File{Name: "partner.dmg", Size: 20, LastModified: now.Add(-2 * time.Hour)},
+		},
+	}
+}
+
+func fileNames(l *PrefixListing) []string {
+	names := []string{}
+	for _, f := range l.Files {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestListOptionsApply(t *testing.T) {
+	listing := testListing()
+
+	opts := &listOptions{}
+	assert.True(t, listing == opts.Apply(listing), "default options should not copy")
+
+	opts = &listOptions{Sort: "size"}
+	assert.Equal(t, []string{"firefox.exe", "partner.dmg", "firefox.dmg"}, fileNames(opts.Apply(listing)))
+
+	opts = &listOptions{Sort: "modified", Order: "desc"}
+	res := opts.Apply(listing)
+	assert.Equal(t, []string{"firefox.exe", "firefox.dmg", "partner.dmg"}, fileNames(res))
+	assert.Equal(t, []string{"c/", "b/", "a.dmg/"}, res.Prefixes)
+
+	opts = &listOptions{Pattern: "*.dmg"}
+	res = opts.Apply(listing)
+	assert.Equal(t, []string{"firefox.dmg", "partner.dmg"}, fileNames(res))
+	assert.Equal(t, []string{"a.dmg/"}, res.Prefixes)
+
+	assert.Equal(t, []string{"firefox.dmg", "firefox.exe", "partner.dmg"}, fileNames(listing), "original listing should not change")
+}
+
+func TestListOptionsSortValues(t *testing.T) {
+	opts := &listOptions{}
+	assert.Equal(t, "order=desc&sort=name", opts.SortValues("name").Encode())
+	assert.Equal(t, "sort=size", opts.SortValues("size").Encode())
+
+	opts = &listOptions{Sort: "size", Order: "desc", Pattern: "*.dmg"}
+	assert.Equal(t, "pattern=%2A.dmg&sort=size", opts.SortValues("size").Encode())
+}
+
+func TestBucketListerListOptions(t *testing.T) {
+	bl := NewBucketLister("bucket", "/", newMemStorage(testObjects(3)...))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dir/?sort=size&order=desc&pattern=file00[12]", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	res := new(PrefixListing)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), res))
+	assert.Equal(t, []string{"file002", "file001"}, fileNames(res))
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/dir/?sort=modified", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `<a href="?order=desc&amp;sort=modified">Last Modified</a>`)
+
+	for _, query := range []string{"sort=date", "order=up", "pattern=[a"} {
+		recorder = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/dir/?"+query, nil)
+		assert.NoError(t, err)
+		bl.ServeHTTP(recorder, req)
+		assert.Equal(t, 400, recorder.Code, query)
+	}
+}
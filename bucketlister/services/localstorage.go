@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocalStorage is a Storage of a local directory tree
+//
+// Keys are paths relative to Dir. It is meant for running bucketlister
+// without AWS credentials.
+type LocalStorage struct {
+	Dir string
+}
+
+// NewLocalStorage returns a *LocalStorage of dir
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{Dir: dir}
+}
+
+func (l *LocalStorage) path(key string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (l *LocalStorage) object(key string, info os.FileInfo) *Object {
+	return &Object{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime().UTC(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+	}
+}
+
+func localError(key string, err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return &storageError{code: "NoSuchKey", message: key + " does not exist"}
+	case os.IsPermission(err):
+		return &storageError{code: "AccessDenied", message: key + " is not readable"}
+	}
+	return err
+}
+
+// List implements Storage
+//
+// When listing with a "/" delimiter only the directory of input.Prefix is
+// read.
+func (l *LocalStorage) List(input *ListInput) (*ListOutput, error) {
+	dir := input.Prefix[:strings.LastIndex(input.Prefix, "/")+1]
+	root := l.path(dir)
+
+	objects := []*Object{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == root && os.IsNotExist(err) {
+				return nil
+			}
+			return localError(p, err)
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		key := dir + filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			key += "/"
+			if !strings.HasPrefix(key, input.Prefix) && !strings.HasPrefix(input.Prefix, key) {
+				return filepath.SkipDir
+			}
+			if input.Delimiter == "/" && strings.HasPrefix(key, input.Prefix) {
+				// stands in for the directory's contents, which are
+				// grouped into a single prefix
+				objects = append(objects, &Object{Key: key})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode().IsRegular() && strings.HasPrefix(key, input.Prefix) {
+			objects = append(objects, l.object(key, info))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(objectsByKey(objects))
+	return listObjects(objects, input), nil
+}
+
+// Stat implements Storage
+func (l *LocalStorage) Stat(key string) (*Object, error) {
+	info, err := os.Stat(l.path(key))
+	if err != nil {
+		return nil, localError(key, err)
+	}
+	if !info.Mode().IsRegular() || strings.HasSuffix(key, "/") {
+		return nil, localError(key, os.ErrNotExist)
+	}
+	return l.object(key, info), nil
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// Open implements Storage
+func (l *LocalStorage) Open(key string, input *OpenInput) (*ObjectReader, error) {
+	obj, err := l.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if input == nil {
+		input = &OpenInput{}
+	}
+	if input.IfNoneMatch != "" {
+		if etagMatches(input.IfNoneMatch, obj.ETag) {
+			return nil, &storageError{code: "NotModified", message: key + " matches " + input.IfNoneMatch}
+		}
+	} else if !input.IfModifiedSince.IsZero() && !obj.LastModified.Truncate(time.Second).After(input.IfModifiedSince) {
+		return nil, &storageError{code: "NotModified", message: key + " is not modified"}
+	}
+
+	start, length, partial, err := parseRange(input.Range, obj.Size)
+	if err != nil {
+		return nil, err
+	}
+	if !partial {
+		start, length = 0, obj.Size
+	}
+
+	f, err := os.Open(l.path(key))
+	if err != nil {
+		return nil, localError(key, err)
+	}
+
+	res := &ObjectReader{
+		Object:        obj,
+		Body:          &sectionReadCloser{io.NewSectionReader(f, start, length), f},
+		ContentLength: length,
+	}
+	if partial {
+		res.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, obj.Size)
+	}
+	return res, nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifestEntry is one line of a recursive manifest
+type manifestEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// manifestWriter writes manifest entries to w as JSON lines
+type manifestWriter struct {
+	w     http.ResponseWriter
+	enc   *json.Encoder
+	since time.Time
+
+	started bool
+	written int
+}
+
+func (m *manifestWriter) start() {
+	if m.started {
+		return
+	}
+	m.started = true
+	setExpiresIn(time.Minute, m.w)
+	m.w.Header().Set("Content-Type", "application/x-ndjson")
+	m.w.WriteHeader(http.StatusOK)
+}
+
+func (m *manifestWriter) write(p string, obj *Object) error {
+	if strings.HasSuffix(p, "/") {
+		// directory placeholder
+		return nil
+	}
+	if !obj.LastModified.After(m.since) {
+		return nil
+	}
+	m.start()
+	m.written++
+	if m.written%maxPageLimit == 0 {
+		m.flush()
+	}
+	return m.enc.Encode(&manifestEntry{
+		Key:          strings.TrimPrefix(p, "/"),
+		Size:         obj.Size,
+		ETag:         strings.Trim(obj.ETag, `"`),
+		LastModified: obj.LastModified.UTC(),
+	})
+}
+
+func (m *manifestWriter) flush() {
+	if f, ok := m.w.(http.Flusher); ok && m.started {
+		f.Flush()
+	}
+}
+
+// serveManifest writes a recursive listing of the requested directory if
+// ?manifest is set
+//
+// Keys are written in order as JSON lines, merging the listers mounted
+// below the directory. ?since=<RFC 3339 time> limits the manifest to keys
+// modified after since.
+func (b *BucketLister) serveManifest(w http.ResponseWriter, req *http.Request) bool {
+	query := req.URL.Query()
+	if _, ok := query["manifest"]; !ok {
+		return false
+	}
+
+	m := &manifestWriter{w: w, enc: json.NewEncoder(w)}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeError(w, req, invalidArgumentError(fmt.Sprintf("invalid since %q", since)))
+			return true
+		}
+		m.since = t
+	}
+
+	reqPath := req.URL.Path
+	if !strings.HasSuffix(reqPath, "/") {
+		reqPath += "/"
+	}
+
+	lister := b.listerFor(reqPath)
+	if err := lister.walk(reqPath, m.write); err != nil {
+		if !m.started {
+			writeError(w, req, err)
+			return true
+		}
+		log.Printf("Manifest %s/%s was interrupted err: %s", lister.Bucket, lister.keyPrefix(reqPath), err)
+		return true
+	}
+	m.start()
+	return true
+}
+
+// walkFunc is called with the path and object of each key of a walk
+type walkFunc func(p string, obj *Object) error
+
+// walk calls fn for every key below reqPath in path order
+//
+// Keys shadowed by a mounted lister are skipped, the mounted lister's keys
+// are walked in their place.
+func (b *BucketLister) walk(reqPath string, fn walkFunc) error {
+	children := []*BucketLister{}
+	for _, lister := range b.listers {
+		if strings.HasPrefix(lister.mountedAt, reqPath) {
+			children = append(children, lister)
+		}
+	}
+	sort.Sort(SortMountedAt(children))
+
+	shadowed := func(p string) bool {
+		for _, child := range children {
+			if strings.HasPrefix(p, child.mountedAt) {
+				return true
+			}
+		}
+		return false
+	}
+
+	pending := children
+	prefix := b.keyPrefix(reqPath)
+	input := &ListInput{Prefix: prefix}
+	for {
+		var res *ListOutput
+		err := b.listCall(prefix, func() (err error) {
+			res, err = b.Storage.List(input)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range res.Objects {
+			p := b.mountedAt + strings.TrimPrefix(obj.Key, b.basePrefix)
+			for len(pending) > 0 && pending[0].mountedAt < p {
+				if err := pending[0].walk(pending[0].mountedAt, fn); err != nil {
+					return err
+				}
+				pending = pending[1:]
+			}
+			if shadowed(p) {
+				continue
+			}
+			if err := fn(p, obj); err != nil {
+				return err
+			}
+		}
+
+		if res.Next == "" {
+			break
+		}
+		input.Token = res.Next
+	}
+
+	for _, child := range pending {
+		if err := child.walk(child.mountedAt, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketListerManifest(t *testing.T) {
+	storage := bucketsStorage(map[string][]string{
+		"archive": {
+			"pub/a.txt",
+			"pub/firefox-x/b.txt",
+			"pub/firefox-x/empty/",
+			"pub/firefox/stray.txt",
+			"pub/firefox/bundles/c.zip",
+			"pub/thunderbird/d.txt",
+		},
+		"firefox": {
+			"pub/firefox/bundles/shadowed.zip",
+			"pub/firefox/releases/1.0/e.txt",
+		},
+	})
+
+	root := NewBucketLister("archive", "", storage["archive"])
+	firefox := NewBucketLister("firefox", "/pub/firefox/", storage["firefox"])
+	firefox.AddBucketLister(NewBucketLister("archive", "/pub/firefox/bundles/", storage["archive"]))
+	root.AddBucketLister(firefox)
+
+	manifest := func(url string) (int, []string) {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", url, nil)
+		assert.NoError(t, err)
+		root.ServeHTTP(recorder, req)
+
+		keys := []string{}
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, keys
+		}
+		dec := json.NewDecoder(recorder.Body)
+		for dec.More() {
+			entry := new(manifestEntry)
+			assert.NoError(t, dec.Decode(entry))
+			keys = append(keys, entry.Key)
+		}
+		return recorder.Code, keys
+	}
+
+	code, keys := manifest("/pub/?manifest")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{
+		"pub/a.txt",
+		"pub/firefox-x/b.txt",
+		"pub/firefox/bundles/c.zip",
+		"pub/firefox/releases/1.0/e.txt",
+		"pub/thunderbird/d.txt",
+	}, keys)
+
+	code, keys = manifest("/pub/firefox/releases/?manifest")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"pub/firefox/releases/1.0/e.txt"}, keys)
+
+	since := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	code, keys = manifest("/pub/?manifest&since=" + since)
+	assert.Equal(t, 200, code)
+	assert.Empty(t, keys)
+
+	code, _ = manifest("/pub/?manifest&since=yesterday")
+	assert.Equal(t, 400, code)
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	deliverytools "github.com/mozilla-services/product-delivery-tools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewListerTree(t *testing.T) {
+	tree, err := deliverytools.ProdBucketMap.Tree()
+	assert.NoError(t, err)
+
+	mounted := map[string]string{}
+	root, err := NewListerTree(tree, func(bucket, mountedAt string) (*BucketLister, error) {
+		mounted[mountedAt] = bucket
+		return NewBucketLister(bucket, mountedAt, newMemStorage()), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/", root.Mount())
+	assert.Equal(t, "archive", mounted[""])
+	assert.Equal(t, "firefox", mounted["/pub/firefox/"])
+	assert.Len(t, mounted, len(deliverytools.ProdBucketMap.Mounts)+1)
+
+	assert.Equal(t, "/pub/firefox/bundles/", root.listerFor("/pub/firefox/bundles/file").Mount())
+	assert.Equal(t, "/pub/firefox/", root.listerFor("/pub/firefox/releases/").Mount())
+	assert.Equal(t, "/", root.listerFor("/pub/thunderbird/").Mount())
+
+	_, err = NewListerTree(tree, func(bucket, mountedAt string) (*BucketLister, error) {
+		if mountedAt == "/pub/labs/" {
+			return nil, assert.AnError
+		}
+		return NewBucketLister(bucket, mountedAt, newMemStorage()), nil
+	})
+	assert.Equal(t, assert.AnError, err)
+}
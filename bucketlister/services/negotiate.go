@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listingFormat is a representation of a listing
+type listingFormat struct {
+	// Name is used by the format query parameter and in ETags
+	Name        string
+	ContentType string
+}
+
+var (
+	htmlFormat = &listingFormat{Name: "html", ContentType: "text/html"}
+	jsonFormat = &listingFormat{Name: "json", ContentType: "application/json"}
+	atomFormat = &listingFormat{Name: "atom", ContentType: "application/atom+xml"}
+	textFormat = &listingFormat{Name: "text", ContentType: "text/plain; charset=utf-8"}
+	csvFormat  = &listingFormat{Name: "csv", ContentType: "text/csv; charset=utf-8"}
+)
+
+// listingFormats are the supported formats in order of preference
+var listingFormats = []*listingFormat{htmlFormat, jsonFormat, atomFormat, textFormat, csvFormat}
+
+// mediaType returns the content type without parameters
+func (f *listingFormat) mediaType() string {
+	return strings.TrimSpace(strings.SplitN(f.ContentType, ";", 2)[0])
+}
+
+// acceptRange is a media range from an Accept header
+type acceptRange struct {
+	Type    string
+	Subtype string
+	Q       float64
+}
+
+func parseAccept(header string) []acceptRange {
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		r := acceptRange{Q: 1}
+		if slash := strings.Index(mediaType, "/"); slash > 0 {
+			r.Type, r.Subtype = mediaType[:slash], mediaType[slash+1:]
+		} else {
+			r.Type, r.Subtype = mediaType, "*"
+		}
+
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					r.Q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// quality returns the q-value the most specific matching range in ranges
+// gives to mediaType, or -1 if no range matches
+func quality(ranges []acceptRange, mediaType string) float64 {
+	parts := strings.SplitN(mediaType, "/", 2)
+	q, specificity := -1.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.Type == parts[0] && r.Subtype == parts[1]:
+			s = 2
+		case r.Type == parts[0] && r.Subtype == "*":
+			s = 1
+		case r.Type == "*" && r.Subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.Q, s
+		}
+	}
+	return q
+}
+
+// negotiateFormat returns the listing format requested by req
+//
+// The format query parameter overrides the Accept header. If the Accept
+// header matches no format, HTML is returned.
+func negotiateFormat(req *http.Request) (*listingFormat, error) {
+	if name := req.URL.Query().Get("format"); name != "" {
+		for _, f := range listingFormats {
+			if f.Name == name {
+				return f, nil
+			}
+		}
+		return nil, invalidArgumentError(fmt.Sprintf("invalid format %q", name))
+	}
+
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return htmlFormat, nil
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := htmlFormat, 0.0
+	for _, f := range listingFormats {
+		if q := quality(ranges, f.mediaType()); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, nil
+}
+
+// setVary sets the Vary header for representations chosen by
+// negotiateFormat
+func setVary(req *http.Request, w http.ResponseWriter) {
+	if req.URL.Query().Get("format") == "" {
+		w.Header().Set("Vary", "Accept")
+	}
+}
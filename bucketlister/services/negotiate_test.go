@@ -0,0 +1,81 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		URL    string
+		Accept string
+		Format *listingFormat
+	}{
+		{"/", "", htmlFormat},
+		{"/", "application/json", jsonFormat},
+		{"/", "application/json, text/plain;q=0.9", jsonFormat},
+		{"/", "text/plain;q=0.9, application/json;q=0.5", textFormat},
+		{"/", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", htmlFormat},
+		{"/", "*/*", htmlFormat},
+		{"/", "text/*;q=0.5, text/csv", csvFormat},
+		{"/", "application/json;q=0, */*;q=0.1", htmlFormat},
+		{"/", "image/png", htmlFormat},
+		{"/", "application/atom+xml", atomFormat},
+		{"/?format=text", "application/json", textFormat},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.URL, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept", c.Accept)
+		format, err := negotiateFormat(req)
+		assert.NoError(t, err)
+		assert.Equal(t, c.Format.Name, format.Name, c.Accept)
+	}
+
+	req, err := http.NewRequest("GET", "/?format=xls", nil)
+	assert.NoError(t, err)
+	_, err = negotiateFormat(req)
+	assert.Error(t, err)
+}
+
+func TestBucketListerFormats(t *testing.T) {
+	modified := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	bl := NewBucketLister("bucket", "/", newMemStorage(
+		&Object{Key: "dir/a+b.txt", LastModified: modified, Size: 10},
+		&Object{Key: "dir/sub/c.txt", LastModified: modified, Size: 10},
+	))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://archive.example.com/dir/?format=text", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Empty(t, recorder.Header().Get("Vary"), "format override does not vary on Accept")
+	assert.Equal(t, "http://archive.example.com/dir/sub/\nhttp://archive.example.com/dir/a%2Bb.txt\n", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://archive.example.com/dir/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "text/csv")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", recorder.Header().Get("Vary"))
+	assert.Equal(t, "name,size,last_modified\nsub/,,\na+b.txt,10,2016-01-02T03:04:05Z\n", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("Accept", "application/json, text/plain;q=0.9")
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://archive.example.com/dir/?format=xls", nil)
+	assert.NoError(t, err)
+	bl.ServeHTTP(recorder, req)
+	assert.Equal(t, 400, recorder.Code)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// setObjectHeaders passes the object's metadata through to clients
+func setObjectHeaders(w http.ResponseWriter, obj *Object, contentLength int64, contentRange string) {
+	header := w.Header()
+	setString := func(name, value string) {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	setString("Cache-Control", obj.CacheControl)
+	setString("Content-Encoding", obj.ContentEncoding)
+	setString("Content-Range", contentRange)
+	setString("Content-Type", obj.ContentType)
+	setString("ETag", obj.ETag)
+	header.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+	if !obj.LastModified.IsZero() {
+		header.Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+	header.Set("Accept-Ranges", "bytes")
+}
+
+// proxyObject copies an object from storage to w
+//
+// Range and conditional request headers are passed to storage, and the
+// object's metadata is passed back. An error is returned only if nothing has
+// been written to w.
+func proxyObject(w http.ResponseWriter, req *http.Request, storage Storage, key string) error {
+	if req.Method == "HEAD" {
+		obj, err := storage.Stat(key)
+		if err != nil {
+			return err
+		}
+		setObjectHeaders(w, obj, obj.Size, "")
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	input := &OpenInput{
+		Range:       req.Header.Get("Range"),
+		IfNoneMatch: req.Header.Get("If-None-Match"),
+	}
+	if ims, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil {
+		input.IfModifiedSince = ims
+	}
+
+	res, err := storage.Open(key, input)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	setObjectHeaders(w, res.Object, res.ContentLength, res.ContentRange)
+
+	status := http.StatusOK
+	if res.ContentRange != "" {
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	if _, err := io.Copy(w, res.Body); err != nil {
+		log.Printf("Error proxying %s err: %s", key, err)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"path/filepath"
 	"time"
@@ -54,6 +56,9 @@ func (f *File) SizeString() string {
 type PrefixListing struct {
 	Prefixes []string `json:"prefixes"`
 	Files    []*File  `json:"files"`
+
+	// Next is the cursor for the following page of a paginated listing
+	Next string `json:"next,omitempty"`
 }
 
 // PrefixStructs returns prefix objects
@@ -74,3 +79,36 @@ func (p *PrefixListing) HasFile(key string) *File {
 	}
 	return nil
 }
+
+// HasPrefix returns true if prefix exists in listing
+func (p *PrefixListing) HasPrefix(prefix string) bool {
+	for _, s := range p.Prefixes {
+		if prefix == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ETag returns a hash of the listing's contents
+func (p *PrefixListing) ETag() string {
+	h := sha1.New()
+	for _, prefix := range p.Prefixes {
+		fmt.Fprintf(h, "d\x00%s\n", prefix)
+	}
+	for _, file := range p.Files {
+		fmt.Fprintf(h, "f\x00%s\x00%d\x00%d\n", file.Name, file.Size, file.LastModified.UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LastModified returns the newest LastModified of the listing's files
+func (p *PrefixListing) LastModified() time.Time {
+	var t time.Time
+	for _, file := range p.Files {
+		if file.LastModified.After(t) {
+			t = file.LastModified
+		}
+	}
+	return t
+}
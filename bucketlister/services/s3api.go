@@ -0,0 +1,428 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/mozilla-services/product-delivery-tools"
+)
+
+const s3XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// S3API serves a read-only subset of the S3 REST API
+//
+// Every mount of Mounts is presented as a single virtual bucket named
+// Name, using path style addressing. ListObjects (v1 and v2), GetObject,
+// HeadObject, ListBuckets and GetBucketLocation are supported.
+//
+// Storage holds the Storage of every bucket of Mounts, by bucket suffix.
+type S3API struct {
+	Name    string
+	Mounts  *deliverytools.MountTree
+	Storage map[string]Storage
+}
+
+// NewS3API returns an *S3API
+func NewS3API(name string, mounts *deliverytools.MountTree, storage map[string]Storage) *S3API {
+	return &S3API{
+		Name:    name,
+		Mounts:  mounts,
+		Storage: storage,
+	}
+}
+
+// resolve returns the bucket holding key
+func (a *S3API) resolve(key string) string {
+	return a.Mounts.Resolve(key)
+}
+
+// mountsBelow returns the mounts with a prefix starting with prefix
+func (a *S3API) mountsBelow(prefix string) []deliverytools.BucketMount {
+	mounts := []deliverytools.BucketMount{}
+	a.Mounts.Walk(func(mount, parent *deliverytools.MountTree) {
+		if parent != nil && strings.HasPrefix(mount.Prefix, prefix) {
+			mounts = append(mounts, mount.BucketMount)
+		}
+	})
+	return mounts
+}
+
+// storage returns the Storage of bucket
+func (a *S3API) storage(bucket string) (Storage, error) {
+	storage, ok := a.Storage[bucket]
+	if !ok {
+		return nil, fmt.Errorf("no storage configured for bucket %s", bucket)
+	}
+	return storage, nil
+}
+
+// bucketsFor returns every physical bucket holding keys below prefix
+func (a *S3API) bucketsFor(prefix string) []string {
+	seen := map[string]bool{a.resolve(prefix): true}
+	buckets := []string{a.resolve(prefix)}
+	for _, mount := range a.mountsBelow(prefix) {
+		bucket := mount.Bucket
+		if !seen[bucket] {
+			seen[bucket] = true
+			buckets = append(buckets, bucket)
+		}
+	}
+	return buckets
+}
+
+// ownsPrefix returns true if keys below commonPrefix may resolve to bucket
+func (a *S3API) ownsPrefix(bucket, commonPrefix string) bool {
+	if a.resolve(commonPrefix) == bucket {
+		return true
+	}
+	for _, mount := range a.mountsBelow(commonPrefix) {
+		if mount.Bucket == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// listEntry is a key or common prefix of a merged listing
+type listEntry struct {
+	Name   string
+	Object *Object
+}
+
+type listEntriesByName []*listEntry
+
+func (l listEntriesByName) Len() int { return len(l) }
+
+func (l listEntriesByName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+
+func (l listEntriesByName) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// list returns up to maxKeys keys and common prefixes after startAfter,
+// merged from every bucket that may hold keys below prefix
+//
+// next is the startAfter of the following page, or empty if the listing is
+// complete.
+func (a *S3API) list(prefix, delimiter, startAfter string, maxKeys int64) (entries []*listEntry, next string, err error) {
+	seenPrefixes := make(map[string]bool)
+
+	// cutoff is the lowest name which may be followed by unlisted keys
+	cutoff := ""
+	truncated := false
+
+	for _, bucket := range a.bucketsFor(prefix) {
+		storage, err := a.storage(bucket)
+		if err != nil {
+			return nil, "", err
+		}
+		res, err := storage.List(&ListInput{
+			Prefix:     prefix,
+			Delimiter:  delimiter,
+			StartAfter: startAfter,
+			Limit:      maxKeys,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		last := ""
+		for _, obj := range res.Objects {
+			if obj.Key > last {
+				last = obj.Key
+			}
+			if a.resolve(obj.Key) == bucket {
+				entries = append(entries, &listEntry{Name: obj.Key, Object: obj})
+			}
+		}
+		for _, cp := range res.Prefixes {
+			if cp > last {
+				last = cp
+			}
+			if !seenPrefixes[cp] && a.ownsPrefix(bucket, cp) {
+				seenPrefixes[cp] = true
+				entries = append(entries, &listEntry{Name: cp})
+			}
+		}
+
+		if res.Next != "" {
+			truncated = true
+			if cutoff == "" || last < cutoff {
+				cutoff = last
+			}
+		}
+	}
+
+	sort.Sort(listEntriesByName(entries))
+
+	if truncated {
+		// names after cutoff may be interleaved with unlisted keys of a
+		// truncated bucket, they are returned by the next page instead
+		n := sort.Search(len(entries), func(i int) bool { return entries[i].Name > cutoff })
+		entries = entries[:n]
+	}
+	if int64(len(entries)) > maxKeys {
+		entries = entries[:maxKeys]
+		truncated = true
+	}
+
+	if !truncated {
+		return entries, "", nil
+	}
+	if len(entries) == 0 {
+		return entries, cutoff, nil
+	}
+
+	lastEntry := entries[len(entries)-1]
+	if lastEntry.Object == nil {
+		// skip every key grouped into the common prefix
+		return entries, lastEntry.Name + string(utf8.MaxRune), nil
+	}
+	return entries, lastEntry.Name, nil
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	XMLNS                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Marker                *string          `xml:"Marker"`
+	NextMarker            string           `xml:"NextMarker,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	KeyCount              *int             `xml:"KeyCount"`
+	MaxKeys               int64            `xml:"MaxKeys"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	EncodingType          string           `xml:"EncodingType,omitempty"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	Contents              []s3ListObject   `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type s3ListObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type s3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type s3LocationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	XMLNS   string   `xml:"xmlns,attr"`
+}
+
+type s3ErrorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// s3KeyEscape encodes a key for encoding-type=url
+func s3KeyEscape(key string) string {
+	return strings.Replace(url.QueryEscape(key), "+", "%20", -1)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding XML err: %s", err)
+	}
+}
+
+// writeS3Error writes err as an S3 error document
+func writeS3Error(w http.ResponseWriter, req *http.Request, err error) {
+	code := errorCode(err)
+	status := errorStatus(code)
+	logError(code, status, err)
+
+	if status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	if code == "" {
+		code = "InternalError"
+	}
+
+	res := &s3ErrorResponse{
+		Code:     code,
+		Message:  http.StatusText(status),
+		Resource: req.URL.Path,
+	}
+	if req.Method == "HEAD" {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, res)
+}
+
+// ServeHTTP implements http.Handler
+func (a *S3API) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		writeXML(w, http.StatusMethodNotAllowed, &s3ErrorResponse{
+			Code:     "MethodNotAllowed",
+			Message:  "The specified method is not allowed against this resource.",
+			Resource: req.URL.Path,
+		})
+		return
+	}
+
+	if req.URL.Path == "/" {
+		writeXML(w, http.StatusOK, &s3ListAllMyBucketsResult{
+			XMLNS:   s3XMLNS,
+			Buckets: []s3Bucket{{Name: a.Name, CreationDate: time.Unix(0, 0).UTC().Format(time.RFC3339)}},
+		})
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if parts[0] != a.Name {
+		writeS3Error(w, req, &s3Error{Op: "resolving", Bucket: parts[0], Err: awserr.New("NoSuchBucket", "The specified bucket does not exist", nil)})
+		return
+	}
+
+	if len(parts) == 2 && parts[1] != "" {
+		key := parts[1]
+		storage, err := a.storage(a.resolve(key))
+		if err == nil {
+			err = proxyObject(w, req, storage, key)
+		}
+		if err != nil {
+			writeS3Error(w, req, err)
+		}
+		return
+	}
+
+	if _, ok := req.URL.Query()["location"]; ok {
+		writeXML(w, http.StatusOK, &s3LocationConstraint{XMLNS: s3XMLNS})
+		return
+	}
+
+	a.serveList(w, req)
+}
+
+func (a *S3API) serveList(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	v2 := query.Get("list-type") == "2"
+
+	maxKeys := int64(maxPageLimit)
+	if mk := query.Get("max-keys"); mk != "" {
+		n, err := strconv.ParseInt(mk, 10, 64)
+		if err != nil || n < 0 {
+			writeS3Error(w, req, invalidArgumentError(fmt.Sprintf("invalid max-keys %q", mk)))
+			return
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	res := &s3ListBucketResult{
+		XMLNS:     s3XMLNS,
+		Name:      a.Name,
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   maxKeys,
+	}
+
+	startAfter := ""
+	if v2 {
+		res.StartAfter = query.Get("start-after")
+		res.ContinuationToken = query.Get("continuation-token")
+		startAfter = res.StartAfter
+		if res.ContinuationToken != "" {
+			token, err := base64.URLEncoding.DecodeString(res.ContinuationToken)
+			if err != nil {
+				writeS3Error(w, req, invalidArgumentError("invalid continuation-token"))
+				return
+			}
+			startAfter = string(token)
+		}
+	} else {
+		marker := query.Get("marker")
+		res.Marker = &marker
+		startAfter = marker
+	}
+
+	entries := []*listEntry{}
+	next := ""
+	if maxKeys > 0 {
+		var err error
+		entries, next, err = a.list(res.Prefix, res.Delimiter, startAfter, maxKeys)
+		if err != nil {
+			writeS3Error(w, req, err)
+			return
+		}
+	}
+
+	escape := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		res.EncodingType = "url"
+		escape = s3KeyEscape
+		res.Prefix = escape(res.Prefix)
+		res.Delimiter = escape(res.Delimiter)
+	}
+
+	for _, e := range entries {
+		if e.Object == nil {
+			res.CommonPrefixes = append(res.CommonPrefixes, s3CommonPrefix{Prefix: escape(e.Name)})
+			continue
+		}
+		res.Contents = append(res.Contents, s3ListObject{
+			Key:          escape(e.Name),
+			LastModified: e.Object.LastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         e.Object.ETag,
+			Size:         e.Object.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	res.IsTruncated = next != ""
+	if v2 {
+		count := len(entries)
+		res.KeyCount = &count
+		if next != "" {
+			res.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(next))
+		}
+	} else if next != "" {
+		res.NextMarker = next
+	}
+
+	writeXML(w, http.StatusOK, res)
+}
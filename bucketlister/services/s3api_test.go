@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	deliverytools "github.com/mozilla-services/product-delivery-tools"
+	"github.com/stretchr/testify/assert"
+)
+
+// bucketsStorage returns a memStorage of keys per bucket
+func bucketsStorage(buckets map[string][]string) map[string]Storage {
+	storage := make(map[string]Storage)
+	for bucket, keys := range buckets {
+		storage[bucket] = newMemStorage(memObjects(keys...)...)
+	}
+	return storage
+}
+
+func testS3API(storage map[string]Storage) *S3API {
+	tree, err := deliverytools.BucketMap{
+		Default: "archive",
+		Mounts: []deliverytools.BucketMount{
+			{Prefix: "pub/firefox/bundles/", Bucket: "archive"},
+			{Prefix: "pub/firefox/", Bucket: "firefox"},
+			{Prefix: "pub/labs/", Bucket: "contrib"},
+		},
+	}.Tree()
+	if err != nil {
+		panic(err)
+	}
+	return NewS3API("archive", tree, storage)
+}
+
+func TestS3APIListObjectsV2(t *testing.T) {
+	api := testS3API(bucketsStorage(map[string][]string{
+		"archive": {
+			"pub/firefox/bundles/a.zip",
+			"pub/firefox/releases/stray.txt", // not served, shadowed by firefox
+			"pub/index.html",
+			"pub/thunderbird/1.0/a.txt",
+		},
+		"firefox": {
+			"pub/firefox/nightly/a.txt",
+			"pub/firefox/releases/1.0/a.txt",
+			"pub/firefox/releases/stray.txt",
+		},
+		"contrib": {
+			"pub/labs/a.txt",
+		},
+	}))
+
+	list := func(query string) *s3ListBucketResult {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/archive?list-type=2&"+query, nil)
+		api.ServeHTTP(recorder, req)
+		assert.Equal(t, 200, recorder.Code)
+		res := new(s3ListBucketResult)
+		assert.NoError(t, xml.Unmarshal(recorder.Body.Bytes(), res))
+		return res
+	}
+
+	res := list("prefix=pub/&delimiter=/")
+	assert.False(t, res.IsTruncated)
+	assert.Equal(t, []s3CommonPrefix{{"pub/firefox/"}, {"pub/labs/"}, {"pub/thunderbird/"}}, res.CommonPrefixes)
+	if assert.Len(t, res.Contents, 1) {
+		assert.Equal(t, "pub/index.html", res.Contents[0].Key)
+	}
+
+	// page through the union one key at a time
+	keys := []string{}
+	token := ""
+	for i := 0; i < 20; i++ {
+		res := list("prefix=pub/firefox/&max-keys=1&continuation-token=" + token)
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !res.IsTruncated {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	assert.Equal(t, []string{
+		"pub/firefox/bundles/a.zip",
+		"pub/firefox/nightly/a.txt",
+		"pub/firefox/releases/1.0/a.txt",
+		"pub/firefox/releases/stray.txt",
+	}, keys)
+
+	res = list("prefix=pub/&delimiter=/&max-keys=1")
+	assert.True(t, res.IsTruncated)
+	assert.Equal(t, []s3CommonPrefix{{"pub/firefox/"}}, res.CommonPrefixes)
+	res = list("prefix=pub/&delimiter=/&max-keys=1&continuation-token=" + res.NextContinuationToken)
+	assert.Len(t, res.Contents, 1)
+	assert.Len(t, res.CommonPrefixes, 0)
+}
+
+func TestS3APIObject(t *testing.T) {
+	api := testS3API(bucketsStorage(map[string][]string{
+		"archive": {"pub/index.html"},
+		"firefox": {"pub/firefox/releases/a.txt"},
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/archive/pub/firefox/releases/a.txt", nil)
+	req.Header.Set("Range", "bytes=1-2")
+	api.ServeHTTP(recorder, req)
+	assert.Equal(t, 206, recorder.Code)
+	assert.Equal(t, "ub", recorder.Body.String())
+	assert.Equal(t, "bytes 1-2/26", recorder.Header().Get("Content-Range"))
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("HEAD", "/archive/pub/firefox/releases/a.txt", nil)
+	api.ServeHTTP(recorder, req)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "26", recorder.Header().Get("Content-Length"))
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/archive/missing", nil)
+	api.ServeHTTP(recorder, req)
+	assert.Equal(t, 404, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "<Code>NoSuchKey</Code>")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/other/key", nil)
+	api.ServeHTTP(recorder, req)
+	assert.Equal(t, 404, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "<Code>NoSuchBucket</Code>")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/archive/key", nil)
+	api.ServeHTTP(recorder, req)
+	assert.Equal(t, 405, recorder.Code)
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Storage is a Storage of an S3 bucket
+type S3Storage struct {
+	Bucket string
+
+	svc *s3.S3
+}
+
+// NewS3Storage returns an *S3Storage of bucket
+func NewS3Storage(bucket string, awsSession *session.Session) *S3Storage {
+	return &S3Storage{
+		Bucket: bucket,
+		svc:    s3.New(awsSession),
+	}
+}
+
+// List implements Storage
+func (s *S3Storage) List(input *ListInput) (*ListOutput, error) {
+	listParams := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(input.Prefix),
+	}
+	if input.Delimiter != "" {
+		listParams.Delimiter = aws.String(input.Delimiter)
+	}
+	if input.StartAfter != "" {
+		listParams.StartAfter = aws.String(input.StartAfter)
+	}
+	if input.Token != "" {
+		listParams.ContinuationToken = aws.String(input.Token)
+	}
+	if input.Limit > 0 {
+		listParams.MaxKeys = aws.Int64(input.Limit)
+	}
+
+	res, err := s.svc.ListObjectsV2(listParams)
+	if err != nil {
+		return nil, &s3Error{Op: "listing", Bucket: s.Bucket, Key: input.Prefix, Err: err}
+	}
+
+	out := &ListOutput{
+		Objects:  make([]*Object, 0, len(res.Contents)),
+		Prefixes: make([]string, 0, len(res.CommonPrefixes)),
+	}
+	for _, obj := range res.Contents {
+		out.Objects = append(out.Objects, &Object{
+			Key:          aws.StringValue(obj.Key),
+			Size:         aws.Int64Value(obj.Size),
+			ETag:         aws.StringValue(obj.ETag),
+			LastModified: aws.TimeValue(obj.LastModified),
+		})
+	}
+	for _, cp := range res.CommonPrefixes {
+		out.Prefixes = append(out.Prefixes, aws.StringValue(cp.Prefix))
+	}
+	if aws.BoolValue(res.IsTruncated) {
+		out.Next = aws.StringValue(res.NextContinuationToken)
+	}
+	return out, nil
+}
+
+// Stat implements Storage
+func (s *S3Storage) Stat(key string) (*Object, error) {
+	res, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, &s3Error{Op: "heading", Bucket: s.Bucket, Key: key, Err: err}
+	}
+	return &Object{
+		Key:             key,
+		Size:            aws.Int64Value(res.ContentLength),
+		ETag:            aws.StringValue(res.ETag),
+		LastModified:    aws.TimeValue(res.LastModified),
+		CacheControl:    aws.StringValue(res.CacheControl),
+		ContentEncoding: aws.StringValue(res.ContentEncoding),
+		ContentType:     aws.StringValue(res.ContentType),
+	}, nil
+}
+
+// Open implements Storage
+func (s *S3Storage) Open(key string, input *OpenInput) (*ObjectReader, error) {
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}
+	if input != nil {
+		if input.Range != "" {
+			params.Range = aws.String(input.Range)
+		}
+		if input.IfNoneMatch != "" {
+			params.IfNoneMatch = aws.String(input.IfNoneMatch)
+		}
+		if !input.IfModifiedSince.IsZero() {
+			params.IfModifiedSince = aws.Time(input.IfModifiedSince)
+		}
+	}
+
+	res, err := s.svc.GetObject(params)
+	if err != nil {
+		return nil, &s3Error{Op: "getting", Bucket: s.Bucket, Key: key, Err: err}
+	}
+	obj := &Object{
+		Key:             key,
+		ETag:            aws.StringValue(res.ETag),
+		LastModified:    aws.TimeValue(res.LastModified),
+		CacheControl:    aws.StringValue(res.CacheControl),
+		ContentEncoding: aws.StringValue(res.ContentEncoding),
+		ContentType:     aws.StringValue(res.ContentType),
+	}
+	if res.ContentRange == nil {
+		obj.Size = aws.Int64Value(res.ContentLength)
+	}
+	return &ObjectReader{
+		Object:        obj,
+		Body:          res.Body,
+		ContentLength: aws.Int64Value(res.ContentLength),
+		ContentRange:  aws.StringValue(res.ContentRange),
+	}, nil
+}
+
+// Presign implements Presigner
+func (s *S3Storage) Presign(key string, expires time.Duration) (string, error) {
+	req, _ := s.svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	u, err := req.Presign(expires)
+	if err != nil {
+		return "", &s3Error{Op: "presigning", Bucket: s.Bucket, Key: key, Err: err}
+	}
+	return u, nil
+}
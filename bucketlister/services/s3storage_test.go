@@ -0,0 +1,52 @@
+package services
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla-services/product-delivery-tools/s3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3Storage(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+	for _, key := range []string{"dir/a.txt", "dir/b.txt", "dir/sub/c.txt"} {
+		srv.Put("bucket", key, []byte(key))
+	}
+	storage := NewS3Storage("bucket", srv.Session())
+
+	res, err := storage.List(&ListInput{Prefix: "dir/", Delimiter: "/", Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, res.Objects, 2)
+	assert.NotEmpty(t, res.Next)
+	res, err = storage.List(&ListInput{Prefix: "dir/", Delimiter: "/", Token: res.Next})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/sub/"}, res.Prefixes)
+	assert.Empty(t, res.Next)
+
+	obj, err := storage.Stat("dir/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), obj.Size)
+	assert.Equal(t, srv.Get("bucket", "dir/a.txt").ETag, obj.ETag)
+
+	_, err = storage.Stat("dir/missing.txt")
+	assert.Equal(t, 404, errorStatus(errorCode(err)))
+
+	r, err := storage.Open("dir/a.txt", &OpenInput{Range: "bytes=4-"})
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		assert.Equal(t, "a.txt", string(body))
+		assert.Equal(t, "bytes 4-8/9", r.ContentRange)
+	}
+
+	_, err = storage.Open("dir/a.txt", &OpenInput{IfNoneMatch: obj.ETag})
+	assert.Equal(t, 304, errorStatus(errorCode(err)))
+
+	u, err := storage.Presign("dir/a.txt", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, srv.URL+"/bucket/dir/a.txt?"))
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage is a bucket of objects served by a BucketLister
+type Storage interface {
+	// List returns one page of the objects below input.Prefix
+	List(input *ListInput) (*ListOutput, error)
+
+	// Stat returns the metadata of the object at key
+	Stat(key string) (*Object, error)
+
+	// Open returns the object at key, input may be nil
+	Open(key string, input *OpenInput) (*ObjectReader, error)
+}
+
+// Presigner is implemented by Storage which can grant temporary access to
+// an object by URL
+type Presigner interface {
+	Presign(key string, expires time.Duration) (string, error)
+}
+
+// Object is the metadata of a stored object
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+
+	CacheControl    string
+	ContentEncoding string
+	ContentType     string
+}
+
+// ListInput selects the objects returned by Storage.List
+type ListInput struct {
+	Prefix string
+
+	// Delimiter groups keys into common prefixes, if empty keys are listed
+	// recursively
+	Delimiter string
+
+	// StartAfter lists keys after StartAfter, it is ignored if Token is set
+	StartAfter string
+
+	// Token continues the listing of a previous ListOutput.Next
+	Token string
+
+	// Limit is the most objects and prefixes returned, if 0 maxPageLimit
+	Limit int64
+}
+
+// ListOutput is one page of a listing
+type ListOutput struct {
+	Objects  []*Object
+	Prefixes []string
+
+	// Next is the token of the following page, empty on the last page
+	Next string
+}
+
+// OpenInput are the request headers passed to Storage.Open
+type OpenInput struct {
+	Range           string
+	IfNoneMatch     string
+	IfModifiedSince time.Time
+}
+
+// ObjectReader is an opened object
+type ObjectReader struct {
+	*Object
+	Body io.ReadCloser
+
+	// ContentLength is the length of Body, which is a range of the object if
+	// ContentRange is set
+	ContentLength int64
+	ContentRange  string
+}
+
+// storageError is an error with an S3 error code returned by Storage
+// other than S3
+type storageError struct {
+	code    string
+	message string
+}
+
+func (e *storageError) Code() string {
+	return e.code
+}
+
+func (e *storageError) Error() string {
+	return e.code + ": " + e.message
+}
+
+type objectsByKey []*Object
+
+func (o objectsByKey) Len() int { return len(o) }
+
+func (o objectsByKey) Less(i, j int) bool { return o[i].Key < o[j].Key }
+
+func (o objectsByKey) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+
+// listObjects returns a page of objects, which must be sorted by key, the
+// way S3 would
+//
+// The token of the following page is the last key or prefix returned.
+func listObjects(objects []*Object, input *ListInput) *ListOutput {
+	limit := input.Limit
+	if limit <= 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	after := input.StartAfter
+	if input.Token != "" {
+		after = input.Token
+	}
+
+	res := &ListOutput{
+		Objects:  []*Object{},
+		Prefixes: []string{},
+	}
+	count := int64(0)
+	last := ""
+	for _, obj := range objects {
+		if !strings.HasPrefix(obj.Key, input.Prefix) {
+			continue
+		}
+
+		name := obj.Key
+		isPrefix := false
+		if input.Delimiter != "" {
+			if i := strings.Index(obj.Key[len(input.Prefix):], input.Delimiter); i >= 0 {
+				name = obj.Key[:len(input.Prefix)+i+len(input.Delimiter)]
+				isPrefix = true
+			}
+		}
+		if name <= after || name == last {
+			continue
+		}
+		if count == limit {
+			res.Next = last
+			break
+		}
+
+		last = name
+		count++
+		if isPrefix {
+			res.Prefixes = append(res.Prefixes, name)
+		} else {
+			res.Objects = append(res.Objects, obj)
+		}
+	}
+	return res
+}
+
+// parseRange returns the single byte range of an object of size requested
+// by a Range header
+//
+// ok is false if the whole object should be returned.
+func parseRange(header string, size int64) (start, length int64, ok bool, err error) {
+	invalid := &storageError{code: "InvalidRange", message: fmt.Sprintf("range %q is not satisfiable", header)}
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, 0, false, nil
+	}
+	spec := strings.SplitN(strings.TrimPrefix(header, "bytes="), "-", 2)
+	if len(spec) != 2 {
+		return 0, 0, false, nil
+	}
+
+	if spec[0] == "" {
+		n, err := strconv.ParseInt(spec[1], 10, 64)
+		if err != nil {
+			return 0, 0, false, nil
+		}
+		if n <= 0 || size == 0 {
+			return 0, 0, false, invalid
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(spec[0], 10, 64)
+	if err != nil {
+		return 0, 0, false, nil
+	}
+	end := size - 1
+	if spec[1] != "" {
+		end, err = strconv.ParseInt(spec[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, invalid
+	}
+	return start, end - start + 1, true, nil
+}
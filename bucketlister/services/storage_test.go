@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memStorage is a Storage of objects in memory, the body of every object is
+// its key
+type memStorage struct {
+	objects []*Object
+
+	// pageSize limits the objects and prefixes listed per page if not 0
+	pageSize int64
+
+	// err is returned by every call if set
+	err error
+
+	lists int
+}
+
+func newMemStorage(objects ...*Object) *memStorage {
+	sort.Sort(objectsByKey(objects))
+	return &memStorage{objects: objects}
+}
+
+// memObjects returns objects of keys modified at time.Now()
+func memObjects(keys ...string) []*Object {
+	now := time.Now()
+	objects := make([]*Object, len(keys))
+	for i, key := range keys {
+		objects[i] = &Object{
+			Key:          key,
+			Size:         int64(len(key)),
+			ETag:         `"` + key + `"`,
+			LastModified: now,
+		}
+	}
+	return objects
+}
+
+func (m *memStorage) List(input *ListInput) (*ListOutput, error) {
+	m.lists++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.pageSize > 0 && (input.Limit <= 0 || input.Limit > m.pageSize) {
+		limited := *input
+		limited.Limit = m.pageSize
+		input = &limited
+	}
+	return listObjects(m.objects, input), nil
+}
+
+func (m *memStorage) Stat(key string) (*Object, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, obj := range m.objects {
+		if obj.Key == key {
+			return obj, nil
+		}
+	}
+	return nil, &storageError{code: "NoSuchKey", message: key + " does not exist"}
+}
+
+func (m *memStorage) Open(key string, input *OpenInput) (*ObjectReader, error) {
+	obj, err := m.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	body := key
+	res := &ObjectReader{Object: obj, ContentLength: int64(len(body))}
+	if input != nil {
+		start, length, ok, err := parseRange(input.Range, int64(len(body)))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			body = body[start : start+length]
+			res.ContentLength = length
+			res.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, len(key))
+		}
+	}
+	res.Body = ioutil.NopCloser(strings.NewReader(body))
+	return res, nil
+}
+
+func TestListObjects(t *testing.T) {
+	objects := memObjects("a/1", "a/2", "b", "c/1", "c/2/3", "d")
+
+	res := listObjects(objects, &ListInput{Delimiter: "/", Limit: 2})
+	assert.Equal(t, []string{"a/"}, res.Prefixes)
+	assert.Len(t, res.Objects, 1)
+	assert.Equal(t, "b", res.Objects[0].Key)
+	assert.Equal(t, "b", res.Next)
+
+	res = listObjects(objects, &ListInput{Delimiter: "/", Token: res.Next})
+	assert.Equal(t, []string{"c/"}, res.Prefixes)
+	assert.Len(t, res.Objects, 1)
+	assert.Equal(t, "d", res.Objects[0].Key)
+	assert.Empty(t, res.Next)
+
+	res = listObjects(objects, &ListInput{Prefix: "c/"})
+	assert.Len(t, res.Objects, 2)
+	assert.Empty(t, res.Prefixes)
+
+	res = listObjects(objects, &ListInput{StartAfter: "c/1"})
+	assert.Len(t, res.Objects, 2)
+	assert.Equal(t, "c/2/3", res.Objects[0].Key)
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header        string
+		start, length int64
+		ok, invalid   bool
+	}{
+		{"", 0, 0, false, false},
+		{"bytes=0-3", 0, 4, true, false},
+		{"bytes=5-", 5, 5, true, false},
+		{"bytes=-3", 7, 3, true, false},
+		{"bytes=8-20", 8, 2, true, false},
+		{"bytes=10-", 0, 0, false, true},
+		{"bytes=0-1,3-4", 0, 0, false, false},
+		{"items=0-1", 0, 0, false, false},
+	}
+	for _, c := range cases {
+		start, length, ok, err := parseRange(c.header, 10)
+		assert.Equal(t, c.invalid, err != nil, c.header)
+		assert.Equal(t, c.ok, ok, c.header)
+		assert.Equal(t, c.start, start, c.header)
+		assert.Equal(t, c.length, length, c.header)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localstorage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a/b/c.txt", "a/d.txt", "e.txt"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, ioutil.WriteFile(p, []byte("0123456789"), 0644))
+	}
+	storage := NewLocalStorage(dir)
+
+	res, err := storage.List(&ListInput{Prefix: "a/", Delimiter: "/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/b/"}, res.Prefixes)
+	assert.Len(t, res.Objects, 1)
+	assert.Equal(t, "a/d.txt", res.Objects[0].Key)
+	assert.Equal(t, int64(10), res.Objects[0].Size)
+
+	res, err = storage.List(&ListInput{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Objects, 3)
+	assert.Equal(t, "a/b/c.txt", res.Objects[0].Key)
+
+	res, err = storage.List(&ListInput{Prefix: "missing/", Delimiter: "/"})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Objects)
+
+	obj, err := storage.Stat("e.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", obj.ContentType)
+
+	_, err = storage.Stat("a/")
+	assert.Equal(t, "NoSuchKey", errorCode(err))
+	_, err = storage.Stat("../" + filepath.Base(dir) + "/e.txt")
+	assert.Equal(t, "NoSuchKey", errorCode(err), "keys are confined to Dir")
+
+	r, err := storage.Open("a/d.txt", &OpenInput{Range: "bytes=2-4"})
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "234", string(body))
+	assert.Equal(t, "bytes 2-4/10", r.ContentRange)
+
+	_, err = storage.Open("e.txt", &OpenInput{IfNoneMatch: obj.ETag})
+	assert.Equal(t, "NotModified", errorCode(err))
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mozilla-services/product-delivery-tools/mozversion"
+)
+
+// listingStreamer writes an HTML listing to w as pages arrive from S3
+//
+// Listings that fit in a single page, and directories containing an
+// index.html, are not streamed so that they can be served with validators.
+// The header is written with the first page. Rows are held back until the
+// last page and written like unstreamed listings, directories first in
+// version order, so the listing looks the same whether or not it was cached.
+//
+// A failed write stops the stream but not the listing, which may be shared
+// with other requests through the cache.
+type listingStreamer struct {
+	lister *BucketLister
+	w      http.ResponseWriter
+	req    *http.Request
+	prefix string
+	path   string
+
+	prefixes []string
+	files    []*File
+
+	skip     bool
+	started  bool
+	finished bool
+	err      error
+}
+
+func (s *listingStreamer) onPage(page *PrefixListing, last bool) {
+	if s.skip || s.err != nil {
+		return
+	}
+	s.err = s.writePage(page, last)
+	if s.err != nil {
+		log.Printf("Error streaming listing %s err: %s", s.path, s.err)
+	}
+}
+
+func (s *listingStreamer) writePage(page *PrefixListing, last bool) error {
+	if !s.started {
+		if last || page.HasFile("index.html") != nil || s.hasIndex() {
+			s.skip = true
+			return nil
+		}
+		s.started = true
+
+		setExpiresIn(15*time.Minute, s.w)
+		setVary(s.req, s.w)
+		s.w.Header().Set("Content-Type", "text/html")
+		s.w.WriteHeader(http.StatusOK)
+
+		if err := listTemplate.ExecuteTemplate(s.w, "header", s.input(page)); err != nil {
+			return err
+		}
+	}
+
+	s.prefixes = append(s.prefixes, page.Prefixes...)
+	s.files = append(s.files, page.Files...)
+
+	if last {
+		sort.Sort(mozversion.Slice(s.prefixes))
+		rows := &PrefixListing{Prefixes: s.prefixes, Files: s.files}
+		if err := listTemplate.ExecuteTemplate(s.w, "rows", s.input(rows)); err != nil {
+			return err
+		}
+		if err := listTemplate.ExecuteTemplate(s.w, "footer", s.input(new(PrefixListing))); err != nil {
+			return err
+		}
+		s.finished = true
+	}
+
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (s *listingStreamer) input(page *PrefixListing) *listTemplateInput {
+	return &listTemplateInput{
+		Path:          s.path,
+		PrefixListing: page,
+	}
+}
+
+// hasIndex returns true if the directory being streamed has an index.html
+//
+// If it cannot be determined the listing is not streamed.
+func (s *listingStreamer) hasIndex() bool {
+	_, err := s.lister.Storage.Stat(s.prefix + "index.html")
+	if err == nil {
+		return true
+	}
+	return errorStatus(errorCode(err)) != http.StatusNotFound
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"html/template"
 	"path"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +19,28 @@ type listFileInfo struct {
 type listTemplateInput struct {
 	Path          string
 	PrefixListing *PrefixListing
+
+	// Limit is the page size of a paginated listing
+	Limit int64
+
+	Options listOptions
+}
+
+// SortURL returns a link sorting the listing by column
+func (l *listTemplateInput) SortURL(column string) string {
+	values := l.Options.SortValues(column)
+	if l.Limit > 0 {
+		values.Set("limit", strconv.FormatInt(l.Limit, 10))
+	}
+	return "?" + values.Encode()
+}
+
+// NextURL returns a link to the next page of a paginated listing
+func (l *listTemplateInput) NextURL() string {
+	values := l.Options.Values()
+	values.Set("limit", strconv.FormatInt(l.Limit, 10))
+	values.Set("after", l.PrefixListing.Next)
+	return "?" + values.Encode()
 }
 
 func (l *listTemplateInput) PathEscaped() string {
@@ -40,7 +63,10 @@ func (l *listTemplateInput) Parent() string {
 	return d
 }
 
-var listTemplate = template.Must(template.New("List").Parse(`<!DOCTYPE html>
+var listTemplate = template.Must(template.New("List").Parse(`{{template "header" .}}{{template "rows" .}}{{template "footer" .}}`))
+
+func init() {
+	template.Must(listTemplate.New("header").Parse(`<!DOCTYPE html>
 <html>
 	<head>
 		<meta charset="UTF-8">
@@ -51,9 +77,9 @@ var listTemplate = template.Must(template.New("List").Parse(`<!DOCTYPE html>
 		<table>
 			<tr>
 				<th>Type</th>
-				<th>Name</th>
-				<th>Size</th>
-				<th>Last Modified</th>
+				<th><a href="{{.SortURL "name"}}">Name</a></th>
+				<th><a href="{{.SortURL "size"}}">Size</a></th>
+				<th><a href="{{.SortURL "modified"}}">Last Modified</a></th>
 			</tr>
 			{{if ne $.Path "/"}}
 			<tr>
@@ -63,6 +89,11 @@ var listTemplate = template.Must(template.New("List").Parse(`<!DOCTYPE html>
 				<td></td>
 			</tr>
 			{{end}}
+`))
+
+	template.Must(listTemplate.New("rows").Parse(`{{template "dirs" .}}{{template "files" .}}`))
+
+	template.Must(listTemplate.New("dirs").Parse(`
 			{{range $dir := .PrefixListing.PrefixStructs}}
 			<tr>
 				<td>Dir</td>
@@ -71,6 +102,9 @@ var listTemplate = template.Must(template.New("List").Parse(`<!DOCTYPE html>
 				<td></td>
 			</tr>
 			{{end}}
+`))
+
+	template.Must(listTemplate.New("files").Parse(`
 			{{range $file := .PrefixListing.Files}}
 			{{if ne $file.Base "."}}
 			<tr>
@@ -81,7 +115,14 @@ var listTemplate = template.Must(template.New("List").Parse(`<!DOCTYPE html>
 			</tr>
 			{{end}}
 			{{end}}
+`))
+
+	template.Must(listTemplate.New("footer").Parse(`
 		</table>
+		{{if .PrefixListing.Next}}
+		<p><a href="{{.NextURL}}">Next page</a></p>
+		{{end}}
 	</body>
 </html>
 `))
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAV is a read-only WebDAV (class 1) interface to a tree of
+// BucketListers
+//
+// PROPFIND with a depth of 0 or 1, GET, HEAD and OPTIONS are supported.
+// PROPFIND request bodies are ignored, every property is always returned.
+type WebDAV struct {
+	Root *BucketLister
+}
+
+// NewWebDAV returns a *WebDAV serving the listers mounted on root
+func NewWebDAV(root *BucketLister) *WebDAV {
+	return &WebDAV{Root: root}
+}
+
+const davAllow = "OPTIONS, GET, HEAD, PROPFIND"
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	XMLNS     string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName      string          `xml:"D:displayname"`
+	ResourceType     davResourceType `xml:"D:resourcetype"`
+	GetContentLength *int64          `xml:"D:getcontentlength,omitempty"`
+	GetLastModified  string          `xml:"D:getlastmodified,omitempty"`
+	SupportedLock    *struct{}       `xml:"D:supportedlock"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+func davHref(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+func davCollection(p string) davResponse {
+	return davResponse{
+		Href: davHref(p),
+		Propstat: davPropstat{
+			Prop: davProp{
+				DisplayName:   path.Base(p),
+				ResourceType:  davResourceType{Collection: &struct{}{}},
+				SupportedLock: &struct{}{},
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+func davFile(p string, file *File) davResponse {
+	size := file.Size
+	res := davResponse{
+		Href: davHref(p),
+		Propstat: davPropstat{
+			Prop: davProp{
+				DisplayName:      file.Base(),
+				GetContentLength: &size,
+				SupportedLock:    &struct{}{},
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+	if !file.LastModified.IsZero() {
+		res.Propstat.Prop.GetLastModified = file.LastModified.UTC().Format(http.TimeFormat)
+	}
+	return res
+}
+
+// listDir returns the listing of the collection at dirPath, which must end
+// with a slash, or nil if it does not exist
+func (d *WebDAV) listDir(dirPath string) (*PrefixListing, error) {
+	lister := d.Root.listerFor(dirPath)
+	listing, _, err := lister.listPrefix(dirPath, lister.keyPrefix(dirPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	if dirPath != lister.mountedAt && len(listing.Files) == 0 && len(listing.Prefixes) == 0 {
+		return nil, nil
+	}
+	return listing, nil
+}
+
+// stat returns the file at reqPath, or isDir if reqPath is a collection
+func (d *WebDAV) stat(reqPath string) (file *File, isDir bool, err error) {
+	if strings.HasSuffix(reqPath, "/") {
+		listing, err := d.listDir(reqPath)
+		return nil, listing != nil, err
+	}
+
+	parent, err := d.listDir(path.Dir(reqPath) + "/")
+	if err != nil || parent == nil {
+		return nil, false, err
+	}
+
+	base := path.Base(reqPath)
+	if file := parent.HasFile(base); file != nil {
+		return file, false, nil
+	}
+	for _, prefix := range parent.Prefixes {
+		if prefix == base+"/" {
+			return nil, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// ServeHTTP implements http.Handler
+func (d *WebDAV) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reqPath := path.Clean("/" + req.URL.Path)
+	if reqPath != "/" && strings.HasSuffix(req.URL.Path, "/") {
+		reqPath += "/"
+	}
+
+	switch req.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", davAllow)
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		d.propfind(w, req, reqPath)
+	case "GET", "HEAD":
+		d.get(w, req, reqPath)
+	default:
+		w.Header().Set("Allow", davAllow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(http.StatusText(http.StatusMethodNotAllowed) + "."))
+	}
+}
+
+func (d *WebDAV) get(w http.ResponseWriter, req *http.Request, reqPath string) {
+	if strings.HasSuffix(reqPath, "/") {
+		d.Root.listerFor(reqPath).ServeHTTP(w, req)
+		return
+	}
+
+	lister := d.Root.listerFor(reqPath + "/")
+	if lister.mountedAt == reqPath+"/" {
+		http.Redirect(w, req, reqPath+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	key := lister.basePrefix + strings.TrimPrefix(reqPath, lister.mountedAt)
+	if err := proxyObject(w, req, lister.Storage, key); err != nil {
+		writeError(w, req, err)
+	}
+}
+
+func (d *WebDAV) propfind(w http.ResponseWriter, req *http.Request, reqPath string) {
+	depth := req.Header.Get("Depth")
+	if depth != "0" && depth != "1" {
+		// infinite depth would list the entire archive
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(http.StatusText(http.StatusForbidden) + "."))
+		return
+	}
+
+	file, isDir, err := d.stat(reqPath)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+
+	ms := &davMultistatus{XMLNS: "DAV:"}
+	switch {
+	case file != nil:
+		ms.Responses = append(ms.Responses, davFile(reqPath, file))
+	case isDir:
+		dirPath := strings.TrimSuffix(reqPath, "/") + "/"
+		ms.Responses = append(ms.Responses, davCollection(dirPath))
+		if depth == "1" {
+			listing, err := d.listDir(dirPath)
+			if err != nil {
+				writeError(w, req, err)
+				return
+			}
+			if listing == nil {
+				listing = &PrefixListing{}
+			}
+			for _, prefix := range listing.Prefixes {
+				ms.Responses = append(ms.Responses, davCollection(dirPath+prefix))
+			}
+			for _, f := range listing.Files {
+				// directory placeholder objects
+				if f.Base() == "." {
+					continue
+				}
+				ms.Responses = append(ms.Responses, davFile(dirPath+f.Base(), f))
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Not Found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	setExpiresIn(time.Minute, w)
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(ms); err != nil {
+		log.Printf("Error encoding PROPFIND response err: %s", err)
+	}
+}
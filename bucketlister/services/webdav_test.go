@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type davTestMultistatus struct {
+	Responses []struct {
+		Href       string    `xml:"href"`
+		Collection *struct{} `xml:"propstat>prop>resourcetype>collection"`
+		Length     string    `xml:"propstat>prop>getcontentlength"`
+	} `xml:"response"`
+}
+
+func TestWebDAVPropfind(t *testing.T) {
+	storage := bucketsStorage(map[string][]string{
+		"archive": {"pub/README", "pub/thunderbird/", "pub/thunderbird/a.txt"},
+		"firefox": {"pub/firefox/a b.txt"},
+	})
+	root := NewBucketLister("archive", "", storage["archive"])
+	root.AddBucketLister(NewBucketLister("firefox", "/pub/firefox/", storage["firefox"]))
+	dav := NewWebDAV(root)
+
+	propfind := func(p, depth string) (*httptest.ResponseRecorder, *davTestMultistatus) {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("PROPFIND", p, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Depth", depth)
+		dav.ServeHTTP(recorder, req)
+		ms := new(davTestMultistatus)
+		if recorder.Code == http.StatusMultiStatus {
+			assert.NoError(t, xml.Unmarshal(recorder.Body.Bytes(), ms))
+		}
+		return recorder, ms
+	}
+
+	recorder, ms := propfind("/pub/", "1")
+	assert.Equal(t, http.StatusMultiStatus, recorder.Code)
+	if assert.Len(t, ms.Responses, 4) {
+		assert.Equal(t, "/pub/", ms.Responses[0].Href)
+		assert.Equal(t, "/pub/firefox/", ms.Responses[1].Href)
+		assert.NotNil(t, ms.Responses[1].Collection)
+		assert.Equal(t, "/pub/thunderbird/", ms.Responses[2].Href)
+		assert.Equal(t, "/pub/README", ms.Responses[3].Href)
+		assert.Nil(t, ms.Responses[3].Collection)
+		assert.Equal(t, "10", ms.Responses[3].Length)
+	}
+
+	recorder, ms = propfind("/pub/firefox/", "1")
+	assert.Equal(t, http.StatusMultiStatus, recorder.Code)
+	if assert.Len(t, ms.Responses, 2) {
+		assert.Equal(t, "/pub/firefox/a%20b.txt", ms.Responses[1].Href)
+	}
+
+	recorder, ms = propfind("/pub/thunderbird/", "1")
+	assert.Equal(t, http.StatusMultiStatus, recorder.Code)
+	if assert.Len(t, ms.Responses, 2, "directory placeholders are not listed") {
+		assert.Equal(t, "/pub/thunderbird/a.txt", ms.Responses[1].Href)
+	}
+
+	recorder, ms = propfind("/pub/firefox/a b.txt", "0")
+	assert.Equal(t, http.StatusMultiStatus, recorder.Code)
+	if assert.Len(t, ms.Responses, 1) {
+		assert.Equal(t, "19", ms.Responses[0].Length)
+	}
+
+	recorder, ms = propfind("/pub/firefox", "0")
+	if assert.Len(t, ms.Responses, 1) {
+		assert.NotNil(t, ms.Responses[0].Collection)
+	}
+
+	recorder, _ = propfind("/pub/missing", "0")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder, _ = propfind("/pub/", "infinity")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/", nil)
+	dav.ServeHTTP(recorder, req)
+	assert.Equal(t, "1", recorder.Header().Get("DAV"))
+}
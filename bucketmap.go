@@ -1,31 +1,159 @@
 package deliverytools
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
 // BucketMap represents the mapping of prefixes to buckets
 type BucketMap struct {
 	// The default or fallthrough bucket
-	Default string
+	Default string `json:"default"`
 
 	// Bucket mappings
-	Mounts []BucketMount
+	Mounts []BucketMount `json:"mounts"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown keys
+func (m *BucketMap) UnmarshalJSON(data []byte) error {
+	type bucketMap BucketMap
+	return unmarshalStrict(data, (*bucketMap)(m))
 }
 
 // BucketMount is a prefix -> bucket mapping
 type BucketMount struct {
-	Prefix string
-	Bucket string
+	Prefix string `json:"prefix"`
+	Bucket string `json:"bucket"`
+
+	// Replicas are buckets written to alongside Bucket at upload time.
+	// Listings are always served from Bucket.
+	Replicas []string `json:"replicas,omitempty"`
+
+	// Policy is the ReplicatePolicy of writes to Replicas, defaults to
+	// ReplicateAll
+	Policy ReplicatePolicy `json:"policy,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown keys
+func (m *BucketMount) UnmarshalJSON(data []byte) error {
+	type bucketMount BucketMount
+	return unmarshalStrict(data, (*bucketMount)(m))
+}
+
+// ReplicatePolicy decides which target buckets of a write must succeed
+type ReplicatePolicy string
+
+const (
+	// ReplicateAll requires writes to the bucket and every replica to
+	// succeed
+	ReplicateAll ReplicatePolicy = "all"
+
+	// ReplicatePrimary requires writes to the bucket to succeed, writes to
+	// replicas are best-effort
+	ReplicatePrimary ReplicatePolicy = "primary"
+)
+
+// Targets returns the buckets written to by uploads to m, Bucket first
+func (m BucketMount) Targets() []string {
+	return append([]string{m.Bucket}, m.Replicas...)
+}
+
+// Required returns true if a failed write to target fails the upload
+func (m BucketMount) Required(target string) bool {
+	return target == m.Bucket || m.Policy != ReplicatePrimary
+}
+
+func (m BucketMount) validateReplicas() error {
+	switch m.Policy {
+	case "", ReplicateAll, ReplicatePrimary:
+	default:
+		return fmt.Errorf("mount %s has unknown policy %q, expected %s or %s", m.Prefix, m.Policy, ReplicateAll, ReplicatePrimary)
+	}
+	seen := map[string]bool{m.Bucket: true}
+	for _, replica := range m.Replicas {
+		if replica == "" || seen[replica] {
+			return fmt.Errorf("mount %s has an empty or duplicated replica %q", m.Prefix, replica)
+		}
+		seen[replica] = true
+	}
+	return nil
 }
 
 // BucketMapping is the current BucketMap
 var ProdBucketMap = BucketMap{
 	Default: "archive",
 	Mounts: []BucketMount{
-		BucketMount{"pub/firefox/bundles/", "archive"},
-		BucketMount{"pub/firefox/try-builds/", "archive"},
-		BucketMount{"pub/firefox/", "firefox"},
-		BucketMount{"pub/labs/", "contrib"},
-		BucketMount{"pub/opus/", "contrib"},
-		BucketMount{"pub/webtools/", "contrib"},
-		BucketMount{"pub/nspr/", "contrib"},
-		BucketMount{"pub/security/", "contrib"},
+		BucketMount{Prefix: "pub/firefox/bundles/", Bucket: "archive"},
+		BucketMount{Prefix: "pub/firefox/try-builds/", Bucket: "archive"},
+		BucketMount{Prefix: "pub/firefox/", Bucket: "firefox"},
+		BucketMount{Prefix: "pub/labs/", Bucket: "contrib"},
+		BucketMount{Prefix: "pub/opus/", Bucket: "contrib"},
+		BucketMount{Prefix: "pub/webtools/", Bucket: "contrib"},
+		BucketMount{Prefix: "pub/nspr/", Bucket: "contrib"},
+		BucketMount{Prefix: "pub/security/", Bucket: "contrib"},
+	},
+}
+
+// DevBucketMap is the bucket map of the dev environment, firefox and
+// everything else in two local buckets
+var DevBucketMap = BucketMap{
+	Default: "archive",
+	Mounts: []BucketMount{
+		BucketMount{Prefix: "pub/firefox/", Bucket: "firefox"},
 	},
 }
+
+// Validate returns an error if m has an empty bucket, a prefix which is
+// empty, duplicated or does not end with a slash, or invalid replicas
+func (m BucketMap) Validate() error {
+	if m.Default == "" {
+		return fmt.Errorf("default bucket is empty")
+	}
+	seen := make(map[string]bool)
+	for _, mount := range m.Mounts {
+		switch {
+		case mount.Prefix == "" || mount.Prefix == "/":
+			return fmt.Errorf("mount of bucket %q has an empty prefix", mount.Bucket)
+		case strings.HasPrefix(mount.Prefix, "/") || !strings.HasSuffix(mount.Prefix, "/"):
+			return fmt.Errorf("mount prefix %q must be relative and end with a slash", mount.Prefix)
+		case mount.Bucket == "":
+			return fmt.Errorf("mount %s has an empty bucket", mount.Prefix)
+		case seen[mount.Prefix]:
+			return fmt.Errorf("mount %s is duplicated", mount.Prefix)
+		}
+		if err := mount.validateReplicas(); err != nil {
+			return err
+		}
+		seen[mount.Prefix] = true
+	}
+	return nil
+}
+
+// LoadBucketMap reads and validates a BucketMap from a JSON file
+func LoadBucketMap(path string) (BucketMap, error) {
+	m := BucketMap{}
+	f, err := os.Open(path)
+	if err != nil {
+		return m, fmt.Errorf("reading bucket map: %s", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return m, fmt.Errorf("parsing bucket map %s: %s", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return m, fmt.Errorf("invalid bucket map %s: %s", path, err)
+	}
+	return m, nil
+}
+
+// BucketMapFlag overrides the bucket map of the environment of all tools
+var BucketMapFlag = cli.StringFlag{
+	Name:   "bucket-map",
+	EnvVar: "DELIVERY_BUCKET_MAP",
+	Usage:  "JSON file of the bucket map, overriding the bucket map of the environment",
+}
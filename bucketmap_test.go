@@ -0,0 +1,91 @@
+package deliverytools
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketMapValidate(t *testing.T) {
+	assert.NoError(t, ProdBucketMap.Validate())
+
+	cases := []BucketMap{
+		{Default: ""},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "", Bucket: "firefox"}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "pub/firefox", Bucket: "firefox"}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "/pub/firefox/", Bucket: "firefox"}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "pub/firefox/", Bucket: ""}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "pub/firefox/", Bucket: "firefox"}, {Prefix: "pub/firefox/", Bucket: "archive"}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "pub/firefox/", Bucket: "firefox", Replicas: []string{"firefox"}}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "pub/firefox/", Bucket: "firefox", Replicas: []string{""}}}},
+		{Default: "archive", Mounts: []BucketMount{{Prefix: "pub/firefox/", Bucket: "firefox", Replicas: []string{"backup"}, Policy: "some"}}},
+	}
+	for _, c := range cases {
+		assert.Error(t, c.Validate(), "%v", c)
+	}
+}
+
+func TestLoadBucketMap(t *testing.T) {
+	f, err := ioutil.TempFile("", "bucketmap")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{
+		"default": "archive",
+		"mounts": [
+			{"prefix": "pub/firefox/", "bucket": "firefox"},
+			{"prefix": "pub/thunderbird/", "bucket": "thunderbird"}
+		]
+	}`)
+	assert.NoError(t, err)
+	f.Close()
+
+	m, err := LoadBucketMap(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, BucketMap{
+		Default: "archive",
+		Mounts: []BucketMount{
+			{Prefix: "pub/firefox/", Bucket: "firefox"},
+			{Prefix: "pub/thunderbird/", Bucket: "thunderbird"},
+		},
+	}, m)
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"default": "archive", "mounts": [{"prefix": "pub/", "bucket": ""}]}`), 0644))
+	_, err = LoadBucketMap(f.Name())
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"default": "archive", "mount": []}`), 0644))
+	_, err = LoadBucketMap(f.Name())
+	assert.Error(t, err, "unknown keys are rejected")
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"default": "archive", "mounts": [{"prefix": "pub/", "bucket": "firefox", "bukket": "x"}]}`), 0644))
+	_, err = LoadBucketMap(f.Name())
+	assert.Error(t, err, "unknown mount keys are rejected")
+
+	_, err = LoadBucketMap(f.Name() + ".missing")
+	assert.Error(t, err)
+}
+
+func TestBucketMountTargets(t *testing.T) {
+	m := BucketMap{
+		Default: "archive",
+		Mounts: []BucketMount{
+			{Prefix: "pub/firefox/", Bucket: "firefox", Replicas: []string{"firefox-backup"}, Policy: ReplicatePrimary},
+			{Prefix: "pub/labs/", Bucket: "contrib", Replicas: []string{"contrib-backup"}},
+		},
+	}
+	tree, err := m.Tree()
+	assert.NoError(t, err)
+
+	firefox := tree.Mount("pub/firefox/releases/")
+	assert.Equal(t, []string{"firefox", "firefox-backup"}, firefox.Targets())
+	assert.True(t, firefox.Required("firefox"))
+	assert.False(t, firefox.Required("firefox-backup"))
+
+	labs := tree.Mount("pub/labs/file")
+	assert.True(t, labs.Required("contrib-backup"), "replicas are required by default")
+
+	assert.Equal(t, BucketMount{Bucket: "archive"}, tree.Mount("pub/thunderbird/"))
+	assert.Equal(t, []string{"archive"}, tree.Mount("pub/thunderbird/").Targets())
+}
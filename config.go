@@ -1,13 +1,239 @@
 package deliverytools
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/codegangsta/cli"
 )
 
-// AWSConfig is the global *aws.Config for all tools
-var AWSSession = session.Must(session.NewSession(
-	&aws.Config{
+// DefaultRegion is the region of buckets without a configured region
+const DefaultRegion = "us-east-1"
+
+// AWSOptions configures the AWS session used for a bucket
+type AWSOptions struct {
+	Region string `json:"region,omitempty"`
+
+	// Endpoint is the URL of an S3 compatible server, such as MinIO or
+	// localstack, to use instead of AWS
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// PathStyle addresses buckets by path rather than by host name
+	PathStyle bool `json:"path_style,omitempty"`
+
+	// Profile is a named profile of the shared AWS config files
+	Profile string `json:"profile,omitempty"`
+
+	// RoleARN is a role assumed with the profile's credentials
+	RoleARN string `json:"role_arn,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown options
+func (o *AWSOptions) UnmarshalJSON(data []byte) error {
+	type options AWSOptions
+	return unmarshalStrict(data, (*options)(o))
+}
+
+// Merge returns o with every option set in override replaced
+func (o AWSOptions) Merge(override AWSOptions) AWSOptions {
+	if override.Region != "" {
+		o.Region = override.Region
+	}
+	if override.Endpoint != "" {
+		o.Endpoint = override.Endpoint
+	}
+	if override.PathStyle {
+		o.PathStyle = true
+	}
+	if override.Profile != "" {
+		o.Profile = override.Profile
+	}
+	if override.RoleARN != "" {
+		o.RoleARN = override.RoleARN
+	}
+	return o
+}
+
+// NewSession returns a *session.Session configured by o
+func (o AWSOptions) NewSession() (*session.Session, error) {
+	config := &aws.Config{
 		MaxRetries: aws.Int(5),
-		Region:     aws.String("us-east-1"),
-	}))
+		Region:     aws.String(DefaultRegion),
+	}
+	if o.Region != "" {
+		config.Region = aws.String(o.Region)
+	}
+	if o.Endpoint != "" {
+		config.Endpoint = aws.String(o.Endpoint)
+	}
+	if o.PathStyle {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	opts := session.Options{Config: *config}
+	if o.Profile != "" {
+		opts.Profile = o.Profile
+		opts.SharedConfigState = session.SharedConfigEnable
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("creating AWS session: %s", err)
+	}
+	if o.RoleARN == "" {
+		return sess, nil
+	}
+
+	// the role is assumed in the bucket's region, not the endpoint's
+	roleConfig := config.Copy()
+	roleConfig.Endpoint = nil
+	roleConfig.S3ForcePathStyle = nil
+	return sess.Copy(&aws.Config{
+		Credentials: stscreds.NewCredentials(sess.Copy(roleConfig), o.RoleARN),
+	}), nil
+}
+
+// AWSConfig is the AWS configuration of every bucket
+type AWSConfig struct {
+	Default AWSOptions `json:"default"`
+
+	// Buckets overrides Default by full bucket name
+	Buckets map[string]AWSOptions `json:"buckets,omitempty"`
+
+	mu       sync.Mutex
+	sessions map[AWSOptions]*session.Session
+}
+
+// Merge returns a new *AWSConfig of c with the default and bucket options
+// of override merged over it
+func (c *AWSConfig) Merge(override *AWSConfig) *AWSConfig {
+	merged := &AWSConfig{
+		Default: c.Default.Merge(override.Default),
+		Buckets: make(map[string]AWSOptions),
+	}
+	for bucket, opts := range c.Buckets {
+		merged.Buckets[bucket] = opts
+	}
+	for bucket, opts := range override.Buckets {
+		merged.Buckets[bucket] = merged.Buckets[bucket].Merge(opts)
+	}
+	return merged
+}
+
+// AWS is the AWS configuration of all tools
+var AWS = &AWSConfig{}
+
+// LoadAWSConfig reads an *AWSConfig from a JSON file
+func LoadAWSConfig(path string) (*AWSConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading AWS config: %s", err)
+	}
+	defer f.Close()
+
+	config := new(AWSConfig)
+	if err := json.NewDecoder(f).Decode(config); err != nil {
+		return nil, fmt.Errorf("parsing AWS config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown keys
+func (c *AWSConfig) UnmarshalJSON(data []byte) error {
+	type config AWSConfig
+	return unmarshalStrict(data, (*config)(c))
+}
+
+// Options returns the options of bucket
+func (c *AWSConfig) Options(bucket string) AWSOptions {
+	return c.Default.Merge(c.Buckets[bucket])
+}
+
+// Session returns the *session.Session of bucket
+//
+// Buckets with the same options share a session.
+func (c *AWSConfig) Session(bucket string) (*session.Session, error) {
+	opts := c.Options(bucket)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sess := c.sessions[opts]; sess != nil {
+		return sess, nil
+	}
+	sess, err := opts.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("bucket %s: %s", bucket, err)
+	}
+	if c.sessions == nil {
+		c.sessions = make(map[AWSOptions]*session.Session)
+	}
+	c.sessions[opts] = sess
+	return sess, nil
+}
+
+// AWSFlags are the flags configuring AWS, shared by all tools
+var AWSFlags = []cli.Flag{
+	cli.StringFlag{Name: "aws-config", EnvVar: "DELIVERY_AWS_CONFIG", Usage: "JSON file of AWS options with per-bucket overrides"},
+	cli.StringFlag{Name: "aws-region", EnvVar: "DELIVERY_AWS_REGION", Usage: "Sets the AWS region, default " + DefaultRegion},
+	cli.StringFlag{Name: "s3-endpoint", EnvVar: "DELIVERY_S3_ENDPOINT", Usage: "Sets the URL of an S3 compatible server to use instead of AWS"},
+	cli.BoolFlag{Name: "s3-path-style", EnvVar: "DELIVERY_S3_PATH_STYLE", Usage: "Addresses buckets by path rather than host name"},
+	cli.StringFlag{Name: "aws-profile", EnvVar: "DELIVERY_AWS_PROFILE", Usage: "Sets the named profile of the shared AWS config files"},
+	cli.StringFlag{Name: "aws-role-arn", EnvVar: "DELIVERY_AWS_ROLE_ARN", Usage: "Sets a role to assume"},
+}
+
+// AWSConfigFromContext returns the *AWSConfig set by AWSFlags
+//
+// Flags override the default options of the --aws-config file. Setting
+// --s3-endpoint implies --s3-path-style.
+func AWSConfigFromContext(c *cli.Context) (*AWSConfig, error) {
+	config := new(AWSConfig)
+	if path := c.GlobalString("aws-config"); path != "" {
+		var err error
+		if config, err = LoadAWSConfig(path); err != nil {
+			return nil, err
+		}
+	}
+
+	config.Default = config.Default.Merge(AWSOptions{
+		Region:    c.GlobalString("aws-region"),
+		Endpoint:  c.GlobalString("s3-endpoint"),
+		PathStyle: c.GlobalBool("s3-path-style") || c.GlobalString("s3-endpoint") != "",
+		Profile:   c.GlobalString("aws-profile"),
+		RoleARN:   c.GlobalString("aws-role-arn"),
+	})
+	return config, nil
+}
+
+// unmarshalStrict unmarshals the JSON object data into v, a pointer to a
+// struct, returning an error for keys which match none of its fields
+//
+// Types call it from UnmarshalJSON with a conversion of themselves to a type
+// without methods.
+func unmarshalStrict(data []byte, v interface{}) error {
+	keys := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	t := reflect.TypeOf(v).Elem()
+	for key := range keys {
+		known := false
+		for i := 0; i < t.NumField() && !known; i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = t.Field(i).Name
+			}
+			known = name != "-" && t.Field(i).PkgPath == "" && strings.EqualFold(name, key)
+		}
+		if !known {
+			return fmt.Errorf("unknown field %q", key)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
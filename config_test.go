@@ -0,0 +1,87 @@
+package deliverytools
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAWSConfigSession(t *testing.T) {
+	config := &AWSConfig{
+		Default: AWSOptions{Region: "us-west-2"},
+		Buckets: map[string]AWSOptions{
+			"minio":  {Endpoint: "http://localhost:9000", PathStyle: true},
+			"eu":     {Region: "eu-central-1"},
+			"eu-two": {Region: "eu-central-1"},
+		},
+	}
+
+	assert.Equal(t, AWSOptions{Region: "us-west-2", Endpoint: "http://localhost:9000", PathStyle: true}, config.Options("minio"))
+
+	sess, err := config.Session("other")
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-2", aws.StringValue(sess.Config.Region))
+	assert.Nil(t, sess.Config.Endpoint)
+
+	sess, err = config.Session("minio")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:9000", aws.StringValue(sess.Config.Endpoint))
+	assert.True(t, aws.BoolValue(sess.Config.S3ForcePathStyle))
+
+	eu, err := config.Session("eu")
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-central-1", aws.StringValue(eu.Config.Region))
+	euTwo, err := config.Session("eu-two")
+	assert.NoError(t, err)
+	assert.True(t, eu == euTwo, "buckets with the same options share a session")
+
+	sess, err = (&AWSConfig{}).Session("bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRegion, aws.StringValue(sess.Config.Region))
+}
+
+func TestAWSConfigFromContext(t *testing.T) {
+	f, err := ioutil.TempFile("", "awsconfig")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{
+		"default": {"region": "us-west-2", "profile": "delivery"},
+		"buckets": {"backup": {"region": "eu-west-1", "role_arn": "arn:aws:iam::123456789012:role/backup"}}
+	}`)
+	assert.NoError(t, err)
+	f.Close()
+
+	var config *AWSConfig
+	app := cli.NewApp()
+	app.Flags = AWSFlags
+	app.Action = func(c *cli.Context) {
+		config, err = AWSConfigFromContext(c)
+	}
+
+	assert.NoError(t, app.Run([]string{"test", "--aws-config", f.Name(), "--s3-endpoint", "http://localhost:9000"}))
+	assert.NoError(t, err)
+	assert.Equal(t, AWSOptions{
+		Region:    "us-west-2",
+		Endpoint:  "http://localhost:9000",
+		PathStyle: true,
+		Profile:   "delivery",
+	}, config.Default)
+	assert.Equal(t, "eu-west-1", config.Options("backup").Region)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/backup", config.Options("backup").RoleARN)
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"default": {"regoin": "us-west-2"}}`), 0644))
+	assert.NoError(t, app.Run([]string{"test", "--aws-config", f.Name()}))
+	assert.Error(t, err, "unknown options are rejected")
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"default": {}, "bucket": {}}`), 0644))
+	assert.NoError(t, app.Run([]string{"test", "--aws-config", f.Name()}))
+	assert.Error(t, err, "unknown keys are rejected")
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"buckets": {"backup": {"role": "arn"}}}`), 0644))
+	assert.NoError(t, app.Run([]string{"test", "--aws-config", f.Name()}))
+	assert.Error(t, err, "unknown bucket options are rejected")
+}
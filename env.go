@@ -0,0 +1,180 @@
+package deliverytools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// ProdEnv is the name of the production environment
+const ProdEnv = "prod"
+
+// Environment is a deployment of the delivery buckets
+type Environment struct {
+	Name string `json:"-"`
+
+	// BucketPrefix is prepended with a dash to the buckets of BucketMap
+	BucketPrefix string `json:"bucket_prefix"`
+
+	// URLPrefix is the public URL of the bucket map's root
+	URLPrefix string `json:"url_prefix"`
+
+	BucketMap BucketMap `json:"bucket_map"`
+
+	// AWS configures the environment's buckets by full bucket name
+	AWS *AWSConfig `json:"aws,omitempty"`
+}
+
+// Environments are the built-in environments by name
+//
+// stage has no built-in bucket map, it must be given by --bucket-map or
+// --env-file.
+var Environments = map[string]*Environment{
+	ProdEnv: {
+		BucketPrefix: "net-mozaws-prod-delivery",
+		URLPrefix:    "https://archive.mozilla.org/",
+		BucketMap:    ProdBucketMap,
+		AWS:          &AWSConfig{},
+	},
+	"stage": {
+		BucketPrefix: "net-mozaws-stage-delivery",
+		URLPrefix:    "https://ftp.stage.mozaws.net/",
+		AWS:          &AWSConfig{},
+	},
+	"dev": {
+		BucketPrefix: "delivery-dev",
+		URLPrefix:    "http://localhost:8888/",
+		BucketMap:    DevBucketMap,
+		AWS: &AWSConfig{
+			Default: AWSOptions{Endpoint: "http://localhost:9000", PathStyle: true},
+		},
+	},
+}
+
+// UnmarshalJSON decodes an environment, rejecting unknown keys
+func (e *Environment) UnmarshalJSON(data []byte) error {
+	type environment Environment
+	return unmarshalStrict(data, (*environment)(e))
+}
+
+// Bucket returns the full name of the bucket with suffix
+func (e *Environment) Bucket(suffix string) string {
+	return e.BucketPrefix + "-" + suffix
+}
+
+// Validate returns an error if e has no bucket prefix or an invalid bucket map
+func (e *Environment) Validate() error {
+	if e.BucketPrefix == "" {
+		return fmt.Errorf("environment %s has an empty bucket prefix", e.Name)
+	}
+	if err := e.BucketMap.Validate(); err != nil {
+		return fmt.Errorf("environment %s: %s", e.Name, err)
+	}
+	return nil
+}
+
+// LoadEnvironments reads and validates environments by name from a JSON file
+func LoadEnvironments(path string) (map[string]*Environment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading environments: %s", err)
+	}
+	defer f.Close()
+
+	envs := make(map[string]*Environment)
+	if err := json.NewDecoder(f).Decode(&envs); err != nil {
+		return nil, fmt.Errorf("parsing environments %s: %s", path, err)
+	}
+	for name, env := range envs {
+		env.Name = name
+		if env.AWS == nil {
+			env.AWS = &AWSConfig{}
+		}
+		if err := env.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid environments %s: %s", path, err)
+		}
+	}
+	return envs, nil
+}
+
+// EnvFlags select the environment of all tools and override its settings
+var EnvFlags = []cli.Flag{
+	cli.StringFlag{Name: "env", EnvVar: "DELIVERY_ENV", Usage: "Sets the environment, one of " + strings.Join(envNames(Environments), ", ")},
+	cli.StringFlag{Name: "env-file", EnvVar: "DELIVERY_ENV_FILE", Usage: "JSON file of environments, replacing built-in environments of the same name"},
+	cli.StringFlag{Name: "bucket-prefix", Usage: "Overrides the S3 bucket prefix of the environment"},
+	BucketMapFlag,
+}
+
+func envNames(envs map[string]*Environment) []string {
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvironmentFromContext returns the *Environment selected by EnvFlags, with
+// the overrides of EnvFlags and AWSFlags applied
+//
+// --env must be set, and environments without a bucket map need
+// --bucket-map. Any environment other than prod using prod's bucket prefix
+// is refused, so a mistyped flag cannot write to prod.
+func EnvironmentFromContext(c *cli.Context) (*Environment, error) {
+	envs := make(map[string]*Environment)
+	for name, env := range Environments {
+		envs[name] = env
+	}
+	if path := c.GlobalString("env-file"); path != "" {
+		loaded, err := LoadEnvironments(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, env := range loaded {
+			envs[name] = env
+		}
+	}
+
+	name := c.GlobalString("env")
+	if name == "" {
+		return nil, fmt.Errorf("--env must be set to one of %s", strings.Join(envNames(envs), ", "))
+	}
+	selected, ok := envs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown environment %q, expected one of %s", name, strings.Join(envNames(envs), ", "))
+	}
+
+	env := *selected
+	env.Name = name
+	if prefix := c.GlobalString("bucket-prefix"); prefix != "" {
+		env.BucketPrefix = prefix
+	}
+	if path := c.GlobalString(BucketMapFlag.Name); path != "" {
+		m, err := LoadBucketMap(path)
+		if err != nil {
+			return nil, err
+		}
+		env.BucketMap = m
+	}
+	if env.BucketMap.Default == "" {
+		return nil, fmt.Errorf("environment %s has no bucket map, set --%s or add it to --env-file", name, BucketMapFlag.Name)
+	}
+	awsConfig, err := AWSConfigFromContext(c)
+	if err != nil {
+		return nil, err
+	}
+	env.AWS = env.AWS.Merge(awsConfig)
+
+	if name != ProdEnv {
+		for _, prod := range []*Environment{Environments[ProdEnv], envs[ProdEnv]} {
+			if env.BucketPrefix == prod.BucketPrefix {
+				return nil, fmt.Errorf("environment %s uses the prod bucket prefix %s, use --env %s to run against prod", name, env.BucketPrefix, ProdEnv)
+			}
+		}
+	}
+	return &env, nil
+}
@@ -0,0 +1,124 @@
+package deliverytools
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func envFromArgs(args ...string) (*Environment, error) {
+	var env *Environment
+	var err error
+	app := cli.NewApp()
+	app.Flags = append(append([]cli.Flag{}, EnvFlags...), AWSFlags...)
+	app.Action = func(c *cli.Context) {
+		env, err = EnvironmentFromContext(c)
+	}
+	if runErr := app.Run(append([]string{"test"}, args...)); runErr != nil {
+		return nil, runErr
+	}
+	return env, err
+}
+
+// resolve returns the bucket of path in the bucket map of env
+func resolve(t *testing.T, env *Environment, path string) string {
+	tree, err := env.BucketMap.Tree()
+	assert.NoError(t, err)
+	return tree.Resolve(path)
+}
+
+func TestEnvironmentFromContext(t *testing.T) {
+	_, err := envFromArgs()
+	assert.Error(t, err, "--env is required")
+
+	_, err = envFromArgs("--env", "qa")
+	assert.Error(t, err)
+
+	env, err := envFromArgs("--env", "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "net-mozaws-prod-delivery-firefox", env.Bucket("firefox"))
+	assert.Equal(t, "https://archive.mozilla.org/", env.URLPrefix)
+	assert.Equal(t, "firefox", resolve(t, env, "pub/firefox/releases/"))
+
+	env, err = envFromArgs("--env", "dev", "--bucket-prefix", "test", "--aws-region", "us-west-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", env.Name)
+	assert.Equal(t, "test-archive", env.Bucket("archive"))
+	assert.Equal(t, AWSOptions{Region: "us-west-2", Endpoint: "http://localhost:9000", PathStyle: true}, env.AWS.Options("test-archive"))
+	assert.Equal(t, "delivery-dev", Environments["dev"].BucketPrefix, "built-in environments are not modified")
+	assert.Equal(t, "", Environments["dev"].AWS.Default.Region)
+
+	_, err = envFromArgs("--env", "dev", "--bucket-prefix", "net-mozaws-prod-delivery")
+	assert.Error(t, err, "only --env prod may use the prod bucket prefix")
+}
+
+func TestEnvironmentBucketMaps(t *testing.T) {
+	env, err := envFromArgs("--env", "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "firefox", resolve(t, env, "pub/firefox/bundles/"))
+	assert.Equal(t, "archive", resolve(t, env, "pub/labs/"))
+
+	_, err = envFromArgs("--env", "stage")
+	assert.Error(t, err, "stage has no built-in bucket map")
+
+	f, err := ioutil.TempFile("", "bucketmap")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"default": "archive", "mounts": [{"prefix": "pub/", "bucket": "stage-pub"}]}`)
+	assert.NoError(t, err)
+	f.Close()
+
+	env, err = envFromArgs("--env", "stage", "--bucket-map", f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "net-mozaws-stage-delivery-stage-pub", env.Bucket(resolve(t, env, "pub/firefox/")))
+	assert.Equal(t, "archive", resolve(t, env, "other/"))
+}
+
+func TestLoadEnvironments(t *testing.T) {
+	f, err := ioutil.TempFile("", "environments")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{
+		"stage": {
+			"bucket_prefix": "delivery-stage",
+			"url_prefix": "https://stage.example.com/",
+			"bucket_map": {"default": "archive", "mounts": [{"prefix": "pub/firefox/", "bucket": "firefox"}]},
+			"aws": {"default": {"region": "us-west-2"}}
+		},
+		"qa": {
+			"bucket_prefix": "delivery-qa",
+			"bucket_map": {"default": "archive"}
+		}
+	}`)
+	assert.NoError(t, err)
+	f.Close()
+
+	env, err := envFromArgs("--env-file", f.Name(), "--env", "stage")
+	assert.NoError(t, err)
+	assert.Equal(t, "delivery-stage-firefox", env.Bucket(resolve(t, env, "pub/firefox/")))
+	assert.Equal(t, "https://stage.example.com/", env.URLPrefix)
+	assert.Equal(t, "us-west-2", env.AWS.Options("delivery-stage-firefox").Region)
+
+	env, err = envFromArgs("--env-file", f.Name(), "--env", "qa")
+	assert.NoError(t, err)
+	assert.Equal(t, "archive", resolve(t, env, "pub/firefox/"))
+
+	env, err = envFromArgs("--env-file", f.Name(), "--env", "dev")
+	assert.NoError(t, err, "built-in environments remain")
+	assert.Equal(t, "delivery-dev", env.BucketPrefix)
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"qa": {"bucket_prefix": "", "bucket_map": {"default": "archive"}}}`), 0644))
+	_, err = envFromArgs("--env-file", f.Name(), "--env", "qa")
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"qa": {"bucket_prefix": "delivery-qa", "bucket_mpa": {"default": "archive"}}}`), 0644))
+	_, err = envFromArgs("--env-file", f.Name(), "--env", "qa")
+	assert.Error(t, err, "unknown keys are rejected")
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"qa": {"bucket_prefix": "net-mozaws-prod-delivery", "bucket_map": {"default": "archive"}}}`), 0644))
+	_, err = envFromArgs("--env-file", f.Name(), "--env", "qa")
+	assert.Error(t, err)
+}
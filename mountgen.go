@@ -0,0 +1,43 @@
+package deliverytools
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+)
+
+// RandomMountedPath is a valid BucketMap with nested prefixes and a path
+// which may fall under them
+//
+// It implements quick.Generator for property tests of bucket resolution.
+type RandomMountedPath struct {
+	Map  BucketMap
+	Path string
+}
+
+// Generate implements quick.Generator
+func (RandomMountedPath) Generate(r *rand.Rand, size int) reflect.Value {
+	segments := []string{"a/", "b/", "c/"}
+	randomPath := func() string {
+		path := ""
+		for n := r.Intn(4); n >= 0; n-- {
+			path += segments[r.Intn(len(segments))]
+		}
+		return path
+	}
+
+	m := RandomMountedPath{Map: BucketMap{Default: "default"}}
+	seen := make(map[string]bool)
+	for n := r.Intn(size + 1); n > 0; n-- {
+		prefix := randomPath()
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		// mounts may share a bucket, as pub/firefox/bundles/ shares archive
+		bucket := strings.Trim(segments[r.Intn(len(segments))]+prefix, "/")
+		m.Map.Mounts = append(m.Map.Mounts, BucketMount{Prefix: prefix, Bucket: strings.Replace(bucket, "/", "-", -1)})
+	}
+	m.Path = randomPath() + "file"
+	return reflect.ValueOf(m)
+}
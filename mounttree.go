@@ -0,0 +1,73 @@
+package deliverytools
+
+import (
+	"sort"
+	"strings"
+)
+
+// MountTree is a mount of a BucketMap and the mounts nested below it
+//
+// The root of a tree has an empty Prefix and the default bucket. Children
+// are sorted by prefix and never contain each other's prefix.
+type MountTree struct {
+	BucketMount
+	Children []*MountTree
+}
+
+type mountsByPrefix []BucketMount
+
+func (m mountsByPrefix) Len() int           { return len(m) }
+func (m mountsByPrefix) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m mountsByPrefix) Less(i, j int) bool { return m[i].Prefix < m[j].Prefix }
+
+// Tree returns the MountTree of m, or an error if m is invalid
+func (m BucketMap) Tree() (*MountTree, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	mounts := append(mountsByPrefix{}, m.Mounts...)
+	sort.Sort(mounts)
+
+	// every mount containing a prefix sorts before it, so its parent is
+	// already in the tree
+	root := &MountTree{BucketMount: BucketMount{Bucket: m.Default}}
+	for _, mount := range mounts {
+		parent := root.Lookup(mount.Prefix)
+		parent.Children = append(parent.Children, &MountTree{BucketMount: mount})
+	}
+	return root, nil
+}
+
+// Lookup returns the deepest mount of t containing path
+func (t *MountTree) Lookup(path string) *MountTree {
+	for _, child := range t.Children {
+		if strings.HasPrefix(path, child.Prefix) {
+			return child.Lookup(path)
+		}
+	}
+	return t
+}
+
+// Mount returns the mount with the longest prefix matching path, or the
+// default mount with an empty prefix
+func (t *MountTree) Mount(path string) BucketMount {
+	return t.Lookup(path).BucketMount
+}
+
+// Resolve returns the bucket holding path
+func (t *MountTree) Resolve(path string) string {
+	return t.Lookup(path).Bucket
+}
+
+// Walk calls fn with t and every mount below it, parents before children
+func (t *MountTree) Walk(fn func(mount, parent *MountTree)) {
+	t.walk(nil, fn)
+}
+
+func (t *MountTree) walk(parent *MountTree, fn func(mount, parent *MountTree)) {
+	fn(t, parent)
+	for _, child := range t.Children {
+		child.walk(t, fn)
+	}
+}
@@ -0,0 +1,113 @@
+package deliverytools
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountTreeResolve(t *testing.T) {
+	reversed := BucketMap{Default: ProdBucketMap.Default}
+	for i := len(ProdBucketMap.Mounts) - 1; i >= 0; i-- {
+		reversed.Mounts = append(reversed.Mounts, ProdBucketMap.Mounts[i])
+	}
+
+	cases := map[string]string{
+		"pub/firefox/bundles/file":      "archive",
+		"pub/firefox/try-builds/file":   "archive",
+		"pub/firefox/releases/":         "firefox",
+		"pub/firefox/":                  "firefox",
+		"pub/firefox":                   "archive",
+		"pub/labs/file":                 "contrib",
+		"pub/thunderbird/releases/file": "archive",
+		"":                              "archive",
+	}
+	tree, err := ProdBucketMap.Tree()
+	assert.NoError(t, err)
+	reversedTree, err := reversed.Tree()
+	assert.NoError(t, err)
+	for path, bucket := range cases {
+		assert.Equal(t, bucket, tree.Resolve(path), path)
+		assert.Equal(t, bucket, reversedTree.Resolve(path), "reversed %s", path)
+	}
+}
+
+func TestBucketMapTree(t *testing.T) {
+	tree, err := BucketMap{
+		Default: "archive",
+		Mounts: []BucketMount{
+			{Prefix: "pub/firefox/nightly/latest/", Bucket: "latest"},
+			{Prefix: "pub/firefox/", Bucket: "firefox"},
+			{Prefix: "pub/labs/", Bucket: "contrib"},
+			{Prefix: "pub/firefox/nightly/", Bucket: "nightly"},
+			{Prefix: "pub/firefox/bundles/", Bucket: "archive"},
+		},
+	}.Tree()
+	assert.NoError(t, err)
+
+	mount := func(prefix, bucket string, children ...*MountTree) *MountTree {
+		return &MountTree{BucketMount{Prefix: prefix, Bucket: bucket}, children}
+	}
+	assert.Equal(t, mount("", "archive",
+		mount("pub/firefox/", "firefox",
+			mount("pub/firefox/bundles/", "archive"),
+			mount("pub/firefox/nightly/", "nightly",
+				mount("pub/firefox/nightly/latest/", "latest"),
+			),
+		),
+		mount("pub/labs/", "contrib"),
+	), tree)
+
+	assert.Equal(t, "pub/firefox/nightly/", tree.Lookup("pub/firefox/nightly/2016/").Prefix)
+	assert.Equal(t, "latest", tree.Resolve("pub/firefox/nightly/latest/file"))
+	assert.Equal(t, "archive", tree.Resolve("pub/thunderbird/"))
+
+	walked := []string{}
+	tree.Walk(func(mount, parent *MountTree) {
+		if parent != nil {
+			assert.Contains(t, walked, parent.Prefix, "parents are walked first")
+		}
+		walked = append(walked, mount.Prefix)
+	})
+	assert.Len(t, walked, 6)
+
+	_, err = BucketMap{}.Tree()
+	assert.Error(t, err)
+}
+
+// longestPrefix is the bucket of the longest mount prefix of path in m
+func longestPrefix(m BucketMap, path string) string {
+	bucket, longest := m.Default, -1
+	for _, mount := range m.Mounts {
+		if len(mount.Prefix) > longest && strings.HasPrefix(path, mount.Prefix) {
+			bucket, longest = mount.Bucket, len(mount.Prefix)
+		}
+	}
+	return bucket
+}
+
+func TestMountTreeResolveProperties(t *testing.T) {
+	longestWins := func(m RandomMountedPath) bool {
+		tree, err := m.Map.Tree()
+		return err == nil && tree.Resolve(m.Path) == longestPrefix(m.Map, m.Path)
+	}
+	assert.NoError(t, quick.Check(longestWins, nil))
+
+	independentOfOrder := func(m RandomMountedPath, seed int64) bool {
+		shuffled := m.Map
+		shuffled.Mounts = nil
+		for _, i := range rand.New(rand.NewSource(seed)).Perm(len(m.Map.Mounts)) {
+			shuffled.Mounts = append(shuffled.Mounts, m.Map.Mounts[i])
+		}
+		tree, err := m.Map.Tree()
+		shuffledTree, shuffledErr := shuffled.Tree()
+		return err == nil && shuffledErr == nil &&
+			reflect.DeepEqual(tree, shuffledTree) &&
+			shuffledTree.Resolve(m.Path) == tree.Resolve(m.Path)
+	}
+	assert.NoError(t, quick.Check(independentOfOrder, nil))
+}
@@ -0,0 +1,153 @@
+// Package mozversion orders Mozilla version strings and directory names
+//
+// Numbers compare numerically, so 10.0 sorts after 9.0 and build10 after
+// build9. Alpha, beta and release candidate suffixes (45.0a1, 45.0b1,
+// 45.0rc1) sort before the release they precede, and an esr suffix sorts
+// directly after its release. Dated directories such as
+// 2016-01-05-03-02-01-mozilla-central sort chronologically.
+package mozversion
+
+import (
+	"strings"
+)
+
+// preReleaseRank orders pre-release markers
+var preReleaseRank = map[string]int{
+	"a":  1,
+	"b":  2,
+	"rc": 3,
+}
+
+// suffixes are channel suffixes that follow a release
+var suffixes = []string{"esr"}
+
+// Slice attaches the methods of sort.Interface to []string, ordering by
+// Compare
+type Slice []string
+
+func (s Slice) Len() int { return len(s) }
+
+func (s Slice) Less(i, j int) bool { return Less(s[i], s[j]) }
+
+func (s Slice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less returns true if a sorts before b
+func Less(a, b string) bool {
+	return Compare(a, b) < 0
+}
+
+// Compare returns -1 if a sorts before b, 1 if a sorts after b and 0 if they
+// are equal
+//
+// A trailing slash is ignored, so directory names may be compared directly.
+func Compare(a, b string) int {
+	a = strings.TrimSuffix(a, "/")
+	b = strings.TrimSuffix(b, "/")
+	coreA, suffixA := splitSuffix(a)
+	coreB, suffixB := splitSuffix(b)
+
+	if c := compareTokens(tokenize(coreA), tokenize(coreB)); c != 0 {
+		return c
+	}
+	if c := strings.Compare(suffixA, suffixB); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func splitSuffix(s string) (string, string) {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) && len(s) > len(suffix) && isDigit(s[len(s)-len(suffix)-1]) {
+			return strings.TrimSuffix(s, suffix), suffix
+		}
+	}
+	return s, ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// tokenize splits s into runs of digits and non-digits
+func tokenize(s string) []string {
+	tokens := []string{}
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || isDigit(s[i]) != isDigit(s[start]) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+	}
+	return tokens
+}
+
+// isPreRelease returns true if tokens[i] is a marker like the b in 45.0b1
+func isPreRelease(tokens []string, i int) bool {
+	if _, ok := preReleaseRank[tokens[i]]; !ok {
+		return false
+	}
+	return i > 0 && isDigit(tokens[i-1][0]) && i+1 < len(tokens) && isDigit(tokens[i+1][0])
+}
+
+func compareTokens(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(a):
+			// a ran out first, 45.0 sorts after 45.0b1 and before 45.0.1
+			if isPreRelease(b, i) {
+				return 1
+			}
+			return -1
+		case i >= len(b):
+			if isPreRelease(a, i) {
+				return -1
+			}
+			return 1
+		}
+
+		if c := compareToken(a, b, i); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareToken(a, b []string, i int) int {
+	ta, tb := a[i], b[i]
+	digitA, digitB := isDigit(ta[0]), isDigit(tb[0])
+
+	if digitA && digitB {
+		return compareNumbers(ta, tb)
+	}
+
+	preA, preB := isPreRelease(a, i), isPreRelease(b, i)
+	switch {
+	case preA && preB:
+		return compareInts(preReleaseRank[ta], preReleaseRank[tb])
+	case preA:
+		return -1
+	case preB:
+		return 1
+	}
+	return strings.Compare(ta, tb)
+}
+
+// compareNumbers compares digit strings of any length numerically
+func compareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package mozversion
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSort(t *testing.T) {
+	ordered := []string{
+		"1.0/",
+		"9.0/",
+		"10.0a1/",
+		"10.0b1/",
+		"10.0b2/",
+		"10.0b10/",
+		"10.0rc1/",
+		"10.0/",
+		"10.0esr/",
+		"10.0.1/",
+		"10.0.1esr/",
+		"10.0.2/",
+		"45.0/",
+		"2015-12-31-03-02-01-mozilla-central/",
+		"2016-01-05-03-02-01-mozilla-central/",
+		"2016-01-05-03-02-01-mozilla-central-l10n/",
+		"2016-01-05-14-02-01-mozilla-central/",
+		"build1/",
+		"build2/",
+		"build10/",
+		"latest-mozilla-central/",
+	}
+
+	shuffled := make([]string, len(ordered))
+	for i, j := range rand.Perm(len(ordered)) {
+		shuffled[i] = ordered[j]
+	}
+
+	sort.Sort(Slice(shuffled))
+	assert.Equal(t, ordered, shuffled)
+}
+
+func TestCompare(t *testing.T) {
+	assert.Equal(t, 0, Compare("45.0", "45.0/"))
+	assert.Equal(t, -1, Compare("45.0b1", "45.0"))
+	assert.Equal(t, 1, Compare("build10", "build9"))
+	assert.Equal(t, -1, Compare("a/", "b/"), "plain names compare lexically")
+	assert.Equal(t, -1, Compare("build01", "build1"), "equal numbers fall back to string order")
+	assert.True(t, Less("99999999999999999999", "100000000000000000000"))
+}
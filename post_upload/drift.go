@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/codegangsta/cli"
+	"github.com/mozilla-services/product-delivery-tools"
+	"github.com/mozilla-services/product-delivery-tools/post_upload/postupload"
+)
+
+var driftCommand = cli.Command{
+	Name:  "drift",
+	Usage: "Report keys below a prefix which differ between primary and replica buckets",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "prefix", Usage: "Prefix to check, ie pub/firefox/releases/"},
+		cli.StringFlag{Name: "replica", Usage: "Replica bucket suffix to compare with, instead of the replicas of each mount"},
+		cli.IntFlag{Name: "parallel", Value: 4, Usage: "Number of bucket pairs checked at once"},
+		cli.BoolFlag{Name: "repair", Usage: "Copy missing keys from the primary to the replica"},
+		cli.BoolFlag{Name: "json", Usage: "Print the report as JSON"},
+	},
+	Action: doDrift,
+}
+
+// driftCheck compares the keys of one mount below Prefix with a replica
+type driftCheck struct {
+	Prefix  string `json:"prefix"`
+	Primary string `json:"primary"`
+	Replica string `json:"replica"`
+
+	Drift []*postupload.Drift `json:"drift"`
+	Error string              `json:"error,omitempty"`
+
+	mount *deliverytools.MountTree
+}
+
+// driftReport is the output of the drift command
+type driftReport struct {
+	Prefix string        `json:"prefix"`
+	Checks []*driftCheck `json:"checks"`
+
+	// Drifted is the number of keys which still differ after repairs
+	Drifted int `json:"drifted"`
+}
+
+// driftChecks returns a check of every mount below prefix with each of its
+// replicas, or with replica if it is set
+//
+// The bucket of prefix is checked from prefix, mounts nested below it are
+// checked from their own prefix.
+func driftChecks(tree *deliverytools.MountTree, prefix, replica string) []*driftCheck {
+	below := []*deliverytools.MountTree{tree.Lookup(prefix)}
+	starts := []string{prefix}
+	below[0].Walk(func(mount, parent *deliverytools.MountTree) {
+		if parent != nil && strings.HasPrefix(mount.Prefix, prefix) {
+			below = append(below, mount)
+			starts = append(starts, mount.Prefix)
+		}
+	})
+
+	checks := []*driftCheck{}
+	for i, mount := range below {
+		replicas := mount.Replicas
+		if replica != "" {
+			replicas = []string{replica}
+		}
+		for _, r := range replicas {
+			checks = append(checks, &driftCheck{
+				Prefix:  starts[i],
+				Primary: env.Bucket(mount.Bucket),
+				Replica: env.Bucket(r),
+				mount:   mount,
+			})
+		}
+	}
+	return checks
+}
+
+func (d *driftCheck) run(repair bool) {
+	lister := func(bucket string) (*postupload.S3ObjectLister, error) {
+		svc, err := s3Service(bucket)
+		if err != nil {
+			return nil, err
+		}
+		return &postupload.S3ObjectLister{Bucket: bucket, Service: svc}, nil
+	}
+	primary, err := lister(d.Primary)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	replica, err := lister(d.Replica)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+
+	// keys of nested mounts are in other buckets
+	skip := func(key string) bool {
+		return mounts.Lookup(key) != d.mount
+	}
+	d.Drift, err = postupload.FindDrift(primary, replica, d.Prefix, skip)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+
+	if !repair {
+		return
+	}
+	remaining := d.Drift[:0]
+	for _, drift := range d.Drift {
+		if drift.Problem == postupload.DriftMissing {
+			if err := s3CopyBetween(d.Primary, d.Replica, drift.Key); err != nil {
+				log.Printf("Error repairing %s:%s err: %s", d.Replica, drift.Key, err)
+			} else {
+				log.Printf("Copied %s to %s", drift.Key, d.Replica)
+				continue
+			}
+		}
+		remaining = append(remaining, drift)
+	}
+	d.Drift = remaining
+}
+
+// runDrift runs checks, parallel at a time, and returns their report
+func runDrift(prefix string, checks []*driftCheck, parallel int, repair bool) *driftReport {
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check *driftCheck) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			check.run(repair)
+		}(check)
+	}
+	wg.Wait()
+
+	report := &driftReport{Prefix: prefix, Checks: checks}
+	for _, check := range checks {
+		report.Drifted += len(check.Drift)
+	}
+	return report
+}
+
+func doDrift(c *cli.Context) {
+	prefix := c.String("prefix")
+	if prefix == "" {
+		log.Fatal("--prefix must be set")
+	}
+
+	checks := driftChecks(mounts, prefix, c.String("replica"))
+	if len(checks) == 0 {
+		log.Fatalf("no mount below %s has replicas, set --replica", prefix)
+	}
+	report := runDrift(prefix, checks, c.Int("parallel"), c.Bool("repair"))
+
+	failed := false
+	for _, check := range report.Checks {
+		failed = failed || check.Error != ""
+	}
+
+	if c.Bool("json") {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(out))
+	} else {
+		printDriftReport(report)
+	}
+
+	if failed || report.Drifted > 0 {
+		os.Exit(1)
+	}
+}
+
+func printDriftReport(report *driftReport) {
+	for _, check := range report.Checks {
+		if check.Error != "" {
+			fmt.Printf("%s -> %s %s: error: %s\n", check.Primary, check.Replica, check.Prefix, check.Error)
+			continue
+		}
+		fmt.Printf("%s -> %s %s: %d drifted\n", check.Primary, check.Replica, check.Prefix, len(check.Drift))
+		for _, d := range check.Drift {
+			switch d.Problem {
+			case postupload.DriftMissing:
+				fmt.Printf("  missing\t%s\n", d.Key)
+			case postupload.DriftSize:
+				fmt.Printf("  size\t%s\t%d != %d\n", d.Key, d.Primary.Size, d.Replica.Size)
+			case postupload.DriftETag:
+				fmt.Printf("  etag\t%s\t%s != %s\n", d.Key, d.Primary.ETag, d.Replica.ETag)
+			}
+		}
+	}
+	fmt.Printf("%d keys drifted below %s\n", report.Drifted, report.Prefix)
+}
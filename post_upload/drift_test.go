@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mozilla-services/product-delivery-tools"
+	"github.com/mozilla-services/product-delivery-tools/post_upload/postupload"
+	"github.com/mozilla-services/product-delivery-tools/s3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriftChecks(t *testing.T) {
+	defer func(e *deliverytools.Environment, m *deliverytools.MountTree) { env, mounts = e, m }(env, mounts)
+	assert.NoError(t, setEnv(&deliverytools.Environment{
+		Name:         "test",
+		BucketPrefix: "test",
+		BucketMap: deliverytools.BucketMap{
+			Default: "archive",
+			Mounts: []deliverytools.BucketMount{
+				{Prefix: "pub/firefox/", Bucket: "firefox", Replicas: []string{"firefox-backup", "firefox-eu"}},
+				{Prefix: "pub/firefox/bundles/", Bucket: "archive", Replicas: []string{"archive-backup"}},
+				{Prefix: "pub/labs/", Bucket: "contrib"},
+			},
+		},
+	}))
+
+	checks := driftChecks(mounts, "pub/firefox/nightly/", "")
+	assert.Len(t, checks, 2)
+	assert.Equal(t, "pub/firefox/nightly/", checks[0].Prefix)
+	assert.Equal(t, "test-firefox", checks[0].Primary)
+	assert.Equal(t, "test-firefox-eu", checks[1].Replica)
+
+	checks = driftChecks(mounts, "pub/", "")
+	assert.Len(t, checks, 3, "nested mounts are checked, mounts without replicas are not")
+	assert.Equal(t, "pub/firefox/bundles/", checks[2].Prefix)
+	assert.Equal(t, "test-archive-backup", checks[2].Replica)
+
+	checks = driftChecks(mounts, "pub/labs/", "contrib-backup")
+	assert.Len(t, checks, 1)
+	assert.Equal(t, "test-contrib-backup", checks[0].Replica)
+}
+
+func TestRunDrift(t *testing.T) {
+	srv := s3test.NewServer("test-firefox", "test-firefox-backup", "test-firefox-remote", "test-archive")
+	defer srv.Close()
+
+	defer func(config *deliverytools.AWSConfig, e *deliverytools.Environment, m *deliverytools.MountTree) {
+		deliverytools.AWS = config
+		env, mounts = e, m
+	}(deliverytools.AWS, env, mounts)
+	defer setTestCredentials()()
+	deliverytools.AWS = &deliverytools.AWSConfig{
+		Default: deliverytools.AWSOptions{Endpoint: srv.URL, PathStyle: true},
+		Buckets: map[string]deliverytools.AWSOptions{
+			// the same server by another name, so repairs stream the object
+			"test-firefox-remote": {Endpoint: strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)},
+		},
+	}
+	assert.NoError(t, setEnv(&deliverytools.Environment{
+		Name:         "test",
+		BucketPrefix: "test",
+		BucketMap: deliverytools.BucketMap{
+			Default: "archive",
+			Mounts: []deliverytools.BucketMount{
+				{Prefix: "pub/firefox/", Bucket: "firefox", Replicas: []string{"firefox-backup", "firefox-remote"}},
+				{Prefix: "pub/firefox/bundles/", Bucket: "archive"},
+			},
+		},
+	}))
+
+	for _, replica := range []string{"test-firefox-backup", "test-firefox-remote"} {
+		srv.Put(replica, "pub/firefox/same", []byte("same"))
+		srv.Put(replica, "pub/firefox/changed", []byte("old"))
+	}
+	srv.Put("test-firefox", "pub/firefox/same", []byte("same"))
+	srv.Put("test-firefox", "pub/firefox/changed", []byte("new"))
+	srv.Put("test-firefox", "pub/firefox/missing", []byte("missing")).ContentType = "text/plain"
+	// larger than a multipart upload part
+	srv.Put("test-firefox", "pub/firefox/large", bytes.Repeat([]byte("l"), 6<<20))
+	srv.Put("test-firefox", "pub/firefox/bundles/stray", []byte("stray"))
+
+	report := runDrift("pub/firefox/", driftChecks(mounts, "pub/firefox/", ""), 2, false)
+	assert.Equal(t, 6, report.Drifted)
+	drift := report.Checks[0].Drift
+	if assert.Len(t, drift, 3) {
+		assert.Equal(t, "pub/firefox/changed", drift[0].Key)
+		assert.Equal(t, postupload.DriftETag, drift[0].Problem)
+		assert.Equal(t, "pub/firefox/large", drift[1].Key)
+		assert.Equal(t, postupload.DriftMissing, drift[1].Problem)
+		assert.Equal(t, "pub/firefox/missing", drift[2].Key)
+	}
+
+	report = runDrift("pub/firefox/", driftChecks(mounts, "pub/firefox/", ""), 2, true)
+	assert.Equal(t, 2, report.Drifted, "only missing keys are repaired")
+	for _, replica := range []string{"test-firefox-backup", "test-firefox-remote"} {
+		copied := srv.Get(replica, "pub/firefox/missing")
+		if assert.NotNil(t, copied, replica) {
+			assert.Equal(t, "missing", string(copied.Body))
+			assert.Equal(t, "text/plain", copied.ContentType)
+		}
+	}
+
+	report = runDrift("pub/firefox/", driftChecks(mounts, "pub/firefox/", ""), 2, false)
+	assert.Equal(t, 2, report.Drifted, "repaired keys do not drift")
+	for _, check := range report.Checks {
+		if assert.Len(t, check.Drift, 1, check.Replica) {
+			assert.Equal(t, "pub/firefox/changed", check.Drift[0].Key)
+		}
+	}
+
+	report = runDrift("pub/", driftChecks(mounts, "pub/", "missing"), 1, false)
+	assert.NotEmpty(t, report.Checks[0].Error)
+}
@@ -25,14 +25,7 @@ GLOBAL OPTIONS:
 var Flags = []cli.Flag{
 	cli.StringFlag{Name: "product, p", Usage: "Set product name to build paths properly."},
 	cli.StringFlag{Name: "version, v", Usage: "Set version number to build paths properly."},
-	cli.StringFlag{
-		Name:  "bucket-prefix",
-		Value: "net-mozaws-prod-delivery",
-		Usage: "Sets S3 bucket prefix"},
-	cli.StringFlag{
-		Name:  "url-prefix",
-		Value: "https://archive.mozilla.org/",
-		Usage: "Sets URL prefix. (Only affects output)"},
+	cli.StringFlag{Name: "url-prefix", Usage: "Overrides the URL prefix of the environment. (Only affects output)"},
 	cli.StringFlag{
 		Name: "nightly-dir", Value: "nightly",
 		Usage: "Set the base directory for nightlies (ie $product/$nightly_dir/}, and the parent directory for release candidates (default 'nightly'}."},
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/quick"
+
+	"github.com/mozilla-services/product-delivery-tools"
+	"github.com/mozilla-services/product-delivery-tools/bucketlister/services"
+	"github.com/mozilla-services/product-delivery-tools/s3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadAndList(t *testing.T) {
+	srv := s3test.NewServer("test-archive", "test-firefox", "test-contrib")
+	defer srv.Close()
+
+	defer func(config *deliverytools.AWSConfig) {
+		deliverytools.AWS = config
+	}(deliverytools.AWS)
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	s3FileCache = map[string]string{}
+
+	dir, err := ioutil.TempDir("", "post_upload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files := []string{
+		filepath.Join(dir, "firefox-50.0a1.en-US.linux-x86_64.tar.bz2"),
+		filepath.Join(dir, "firefox-50.0a1.en-US.linux-x86_64.txt"),
+	}
+	for _, f := range files {
+		assert.NoError(t, ioutil.WriteFile(f, []byte(filepath.Base(f)), 0644))
+	}
+
+	args := []string{"post_upload",
+		"--env", "dev",
+		"--bucket-prefix", "test",
+		"--s3-endpoint", srv.URL,
+		"--product", "firefox",
+		"--branch", "mozilla-central",
+		"--version", "50.0a1",
+		"--build-number", "1",
+		"--release-to-latest",
+		"--release-to-candidates-dir",
+		dir,
+	}
+	assert.NoError(t, newApp().Run(append(args, files...)))
+
+	assert.Empty(t, srv.Keys("test-archive"))
+	assert.Equal(t, []string{
+		"pub/firefox/candidates/50.0a1-candidates/build1/firefox-50.0a1.en-US.linux-x86_64.tar.bz2",
+		"pub/firefox/candidates/50.0a1-candidates/build1/firefox-50.0a1.en-US.linux-x86_64.txt",
+		"pub/firefox/nightly/latest-mozilla-central-l10n/firefox-50.0a1.en-US.linux-x86_64.tar.bz2",
+		"pub/firefox/nightly/latest-mozilla-central/firefox-50.0a1.en-US.linux-x86_64.tar.bz2",
+		"pub/firefox/nightly/latest-mozilla-central/firefox-50.0a1.en-US.linux-x86_64.txt",
+	}, srv.Keys("test-firefox"))
+
+	// mounted the way bucketlister's main does
+	root := services.NewBucketLister("test-archive", "",
+		services.NewS3Storage("test-archive", srv.Session()))
+	firefox := services.NewBucketLister("test-firefox", "/pub/firefox/",
+		services.NewS3Storage("test-firefox", srv.Session()))
+	root.AddBucketLister(firefox)
+	mux := http.NewServeMux()
+	mux.Handle("/", root)
+	mux.Handle("/pub/firefox/", firefox)
+
+	get := func(p string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", p, nil)
+		assert.NoError(t, err)
+		mux.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := get("/pub/firefox/candidates/50.0a1-candidates/build1/")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "firefox-50.0a1.en-US.linux-x86_64.tar.bz2")
+	assert.Contains(t, recorder.Body.String(), "firefox-50.0a1.en-US.linux-x86_64.txt")
+
+	recorder = get("/pub/")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "firefox/")
+
+	recorder = get("/pub/firefox/nightly/latest-mozilla-central/firefox-50.0a1.en-US.linux-x86_64.txt")
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "firefox-50.0a1.en-US.linux-x86_64.txt", recorder.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "max-age=3600", recorder.Header().Get("Cache-Control"))
+
+	recorder = get("/pub/firefox/candidates/50.0a1-candidates/build1/missing.txt")
+	assert.Equal(t, 404, recorder.Code)
+}
+
+// TestUploadAndListingAgree checks that for any bucket map, files are
+// uploaded to the bucket the lister serving their path reads from
+func TestUploadAndListingAgree(t *testing.T) {
+	defer func(config *deliverytools.AWSConfig, e *deliverytools.Environment, m *deliverytools.MountTree) {
+		deliverytools.AWS = config
+		env, mounts = e, m
+	}(deliverytools.AWS, env, mounts)
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+
+	f, err := ioutil.TempFile("", "post_upload")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("build")
+	assert.NoError(t, err)
+	f.Close()
+
+	agree := func(m deliverytools.RandomMountedPath) bool {
+		if err := setEnv(&deliverytools.Environment{Name: "test", BucketPrefix: "test", BucketMap: m.Map}); err != nil {
+			t.Log(err)
+			return false
+		}
+		srv := s3test.NewServer(env.Bucket(m.Map.Default))
+		defer srv.Close()
+		for _, mount := range m.Map.Mounts {
+			srv.CreateBucket(env.Bucket(mount.Bucket))
+		}
+		deliverytools.AWS = &deliverytools.AWSConfig{
+			Default: deliverytools.AWSOptions{Endpoint: srv.URL, PathStyle: true},
+		}
+		s3FileCache = map[string]string{}
+
+		// uploaded as doMain does
+		if _, err := s3CopyFileTargets(f.Name(), mounts.Mount(m.Path), m.Path); err != nil {
+			t.Log(err)
+			return false
+		}
+
+		// mounted as bucketlister's main does
+		mux := http.NewServeMux()
+		root, err := services.NewListerTree(mounts, func(suffix, mountedAt string) (*services.BucketLister, error) {
+			bucket := env.Bucket(suffix)
+			bl := services.NewBucketLister(bucket, mountedAt, services.NewS3Storage(bucket, srv.Session()))
+			if mountedAt != "" {
+				mux.Handle(mountedAt, bl)
+			}
+			return bl, nil
+		})
+		if err != nil {
+			return false
+		}
+		mux.Handle("/", root)
+
+		req, err := http.NewRequest("GET", "/"+m.Path, nil)
+		if err != nil {
+			return false
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder.Code == http.StatusOK && recorder.Body.String() == "build"
+	}
+	assert.NoError(t, quick.Check(agree, &quick.Config{MaxCount: 30}))
+}
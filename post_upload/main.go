@@ -4,14 +4,34 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
 
 	"github.com/codegangsta/cli"
 	"github.com/mozilla-services/product-delivery-tools"
 	"github.com/mozilla-services/product-delivery-tools/post_upload/postupload"
 )
 
+// env is the environment uploaded to and mounts the tree of its bucket map,
+// they are set by --env
+var (
+	env    *deliverytools.Environment
+	mounts *deliverytools.MountTree
+)
+
+// setEnv sets env and mounts
+func setEnv(e *deliverytools.Environment) error {
+	tree, err := e.BucketMap.Tree()
+	if err != nil {
+		return err
+	}
+	env, mounts = e, tree
+	return nil
+}
+
 func main() {
+	newApp().RunAndExitOnError()
+}
+
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "post_upload"
 	app.HideVersion = true
@@ -24,9 +44,20 @@ func main() {
 		},
 	}
 	app.Action = doMain
-	app.Flags = Flags
-
-	app.RunAndExitOnError()
+	app.Flags = append(append(Flags, deliverytools.EnvFlags...), deliverytools.AWSFlags...)
+	app.Commands = []cli.Command{nightliesCommand, driftCommand}
+	app.Before = func(c *cli.Context) error {
+		e, err := deliverytools.EnvironmentFromContext(c)
+		if err != nil {
+			return err
+		}
+		if c.GlobalString("url-prefix") != "" {
+			e.URLPrefix = c.GlobalString("url-prefix")
+		}
+		deliverytools.AWS = e.AWS
+		return setEnv(e)
+	}
+	return app
 }
 
 func contextToOptions(c *cli.Context, r *postupload.Release) {
@@ -84,7 +115,7 @@ func doMain(c *cli.Context) {
 	uploadDir := c.Args()[0]
 	files := c.Args()[1:]
 
-	requireArgs("product", "bucket-prefix")
+	requireArgs("product")
 
 	release := postupload.NewRelease(uploadDir, c.String("product"))
 
@@ -105,7 +136,6 @@ func doMain(c *cli.Context) {
 
 	contextToOptions(c, release)
 
-	bucketPrefix := c.String("bucket-prefix")
 	for _, f := range files {
 		if _, err := os.Stat(f); os.IsNotExist(err) {
 			log.Fatalf("Error: %s does not exist.\n", f)
@@ -124,28 +154,33 @@ func doMain(c *cli.Context) {
 		}
 
 		for _, dest := range dests {
-			bucket := bucketPrefix + "-" + destToBucket(dest)
-			url := c.String("url-prefix") + dest
+			mount := mounts.Mount(dest)
+			url := env.URLPrefix + dest
 			if c.Bool("dry-run") {
-				fmt.Printf("%s -> %s:%s\n", file, bucket, dest)
+				for _, target := range mount.Targets() {
+					fmt.Printf("%s -> %s:%s\n", file, env.Bucket(target), dest)
+				}
 				fmt.Fprintln(os.Stderr, url)
 				continue
 			}
-			if err := s3CopyFile(file, bucket, dest); err != nil {
+
+			results, err := s3CopyFileTargets(file, mount, dest)
+			if len(results) > 1 {
+				for _, result := range results {
+					switch {
+					case result.Err == nil:
+						log.Printf("Wrote %s:%s", result.Bucket, dest)
+					case result.Required:
+						log.Printf("Error writing %s:%s err: %s", result.Bucket, dest, result.Err)
+					default:
+						log.Printf("Error writing best-effort replica %s:%s err: %s", result.Bucket, dest, result.Err)
+					}
+				}
+			}
+			if err != nil {
 				log.Fatal(err)
-			} else {
-				fmt.Fprintln(os.Stderr, url)
 			}
+			fmt.Fprintln(os.Stderr, url)
 		}
 	}
 }
-
-func destToBucket(dest string) string {
-	for _, pathMount := range deliverytools.ProdBucketMap.Mounts {
-		if strings.HasPrefix(dest, pathMount.Prefix) {
-			return pathMount.Bucket
-		}
-	}
-
-	return deliverytools.ProdBucketMap.Default
-}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/codegangsta/cli"
+	"github.com/mozilla-services/product-delivery-tools"
+	"github.com/mozilla-services/product-delivery-tools/post_upload/postupload"
+)
+
+var nightliesCommand = cli.Command{
+	Name:  "nightlies",
+	Usage: "List dated nightly builds of a branch in chronological order",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "product, p", Usage: "Product name, ie firefox"},
+		cli.StringFlag{Name: "branch, b", Usage: "Branch name, ie mozilla-central"},
+		cli.StringFlag{Name: "nightly-dir", Value: "nightly", Usage: "Base directory for nightlies"},
+		cli.StringFlag{Name: "from", Usage: "First build date to include, YYYY-MM-DD"},
+		cli.StringFlag{Name: "to", Usage: "Last build date to include, YYYY-MM-DD"},
+	},
+	Action: doNightlies,
+}
+
+// parseDate parses a YYYY-MM-DD date in the timezone build ids use
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("2006-01-02", date, loc)
+}
+
+func doNightlies(c *cli.Context) {
+	if c.String("product") == "" || c.String("branch") == "" {
+		log.Fatal("--product and --branch must be set")
+	}
+
+	from, err := parseDate(c.String("from"))
+	if err != nil {
+		log.Fatalf("invalid --from: %s", err)
+	}
+	to, err := parseDate(c.String("to"))
+	if err != nil {
+		log.Fatalf("invalid --to: %s", err)
+	}
+	if !to.IsZero() {
+		// --to is inclusive
+		to = to.AddDate(0, 0, 1)
+	}
+
+	release := postupload.NewRelease("", c.String("product"))
+	release.Branch = c.String("branch")
+	release.NightlyDir = c.String("nightly-dir")
+
+	bucket := env.Bucket(mounts.Resolve(release.NightlyPath() + "/"))
+	awsSession, err := deliverytools.AWS.Session(bucket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lister := &postupload.S3DirLister{
+		Bucket:  bucket,
+		Service: s3.New(awsSession),
+	}
+
+	builds, err := release.FindNightlies(lister, from, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, build := range builds {
+		fmt.Fprintf(os.Stdout, "%s\t%s%s/\n", build.BuildID, env.URLPrefix, build.Path)
+	}
+}
@@ -0,0 +1,182 @@
+package postupload
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectInfo is the size and ETag of an object
+type ObjectInfo struct {
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+// Object is a key and its ObjectInfo
+type Object struct {
+	Key string
+	ObjectInfo
+}
+
+// ObjectLister lists every object below a prefix
+type ObjectLister interface {
+	// ListObjects calls fn with each page of objects below prefix in key
+	// order, until fn returns false
+	ListObjects(prefix string, fn func(page []Object) bool) error
+}
+
+// S3ObjectLister lists objects in an S3 bucket
+type S3ObjectLister struct {
+	Bucket  string
+	Service *s3.S3
+}
+
+// ListObjects calls fn with each page of objects below prefix
+func (s *S3ObjectLister) ListObjects(prefix string, fn func(page []Object) bool) error {
+	err := s.Service.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		objects := make([]Object, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, Object{
+				Key: aws.StringValue(obj.Key),
+				ObjectInfo: ObjectInfo{
+					Size: aws.Int64Value(obj.Size),
+					ETag: aws.StringValue(obj.ETag),
+				},
+			})
+		}
+		return fn(objects)
+	})
+	if err != nil {
+		return fmt.Errorf("listing %s/%s err: %s", s.Bucket, prefix, err)
+	}
+	return nil
+}
+
+// objectCursor walks the pages of a listing running in its own goroutine
+type objectCursor struct {
+	pages <-chan []Object
+	page  []Object
+	errc  <-chan error
+}
+
+// listObjects starts listing prefix, stopping early once done is closed
+func listObjects(lister ObjectLister, prefix string, done <-chan struct{}) *objectCursor {
+	pages := make(chan []Object)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(pages)
+		errc <- lister.ListObjects(prefix, func(page []Object) bool {
+			select {
+			case pages <- page:
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+	return &objectCursor{pages: pages, errc: errc}
+}
+
+// peek returns the next object without consuming it, false once the listing
+// has ended
+func (c *objectCursor) peek() (Object, bool) {
+	for len(c.page) == 0 {
+		page, ok := <-c.pages
+		if !ok {
+			return Object{}, false
+		}
+		c.page = page
+	}
+	return c.page[0], true
+}
+
+// next consumes the object returned by peek
+func (c *objectCursor) next() {
+	c.page = c.page[1:]
+}
+
+// wait discards the remaining pages and returns the error of the listing
+func (c *objectCursor) wait() error {
+	for range c.pages {
+	}
+	return <-c.errc
+}
+
+// Drift problems
+const (
+	DriftMissing = "missing"
+	DriftSize    = "size"
+	DriftETag    = "etag"
+)
+
+// Drift is a key of a primary bucket which differs in its replica
+type Drift struct {
+	Key     string      `json:"key"`
+	Problem string      `json:"problem"`
+	Primary ObjectInfo  `json:"primary"`
+	Replica *ObjectInfo `json:"replica,omitempty"`
+}
+
+// FindDrift returns the keys below prefix which are missing from replica or
+// differ in size or ETag, sorted by key
+//
+// Both buckets are listed in parallel and merged one page at a time, so only
+// the current page of each listing is held in memory. Keys for which skip
+// returns true are not compared, skip may be nil. Objects uploaded in parts
+// of different sizes have different ETags even if their contents match.
+func FindDrift(primary, replica ObjectLister, prefix string, skip func(key string) bool) ([]*Drift, error) {
+	done := make(chan struct{})
+	primaryObjects := listObjects(primary, prefix, done)
+	replicaObjects := listObjects(replica, prefix, done)
+
+	drift := []*Drift{}
+	for {
+		obj, ok := primaryObjects.peek()
+		if !ok {
+			break
+		}
+		primaryObjects.next()
+
+		replicaObj, found := replicaObjects.peek()
+		for found && replicaObj.Key < obj.Key {
+			replicaObjects.next()
+			replicaObj, found = replicaObjects.peek()
+		}
+		found = found && replicaObj.Key == obj.Key
+
+		if skip != nil && skip(obj.Key) {
+			continue
+		}
+		d := &Drift{Key: obj.Key, Primary: obj.ObjectInfo}
+		switch {
+		case !found:
+			d.Problem = DriftMissing
+		case replicaObj.Size != obj.Size:
+			d.Problem = DriftSize
+		case replicaObj.ETag != obj.ETag:
+			d.Problem = DriftETag
+		default:
+			continue
+		}
+		if found {
+			info := replicaObj.ObjectInfo
+			d.Replica = &info
+		}
+		drift = append(drift, d)
+	}
+
+	close(done)
+	primaryErr := primaryObjects.wait()
+	replicaErr := replicaObjects.wait()
+	if primaryErr != nil {
+		return nil, primaryErr
+	}
+	if replicaErr != nil {
+		return nil, replicaErr
+	}
+	return drift, nil
+}
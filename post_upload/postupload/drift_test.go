@@ -0,0 +1,81 @@
+package postupload
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapObjectLister lists its objects in pages of two keys
+type mapObjectLister map[string]ObjectInfo
+
+func (m mapObjectLister) ListObjects(prefix string, fn func(page []Object) bool) error {
+	keys := []string{}
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	page := []Object{}
+	for i, key := range keys {
+		page = append(page, Object{Key: key, ObjectInfo: m[key]})
+		if len(page) == 2 || i == len(keys)-1 {
+			if !fn(page) {
+				return nil
+			}
+			page = []Object{}
+		}
+	}
+	return nil
+}
+
+type errObjectLister struct{}
+
+func (errObjectLister) ListObjects(prefix string, fn func(page []Object) bool) error {
+	return errors.New("listing failed")
+}
+
+func TestFindDrift(t *testing.T) {
+	primary := mapObjectLister{
+		"pub/firefox/a":         {Size: 1, ETag: `"a"`},
+		"pub/firefox/b":         {Size: 2, ETag: `"b"`},
+		"pub/firefox/c":         {Size: 3, ETag: `"c"`},
+		"pub/firefox/d":         {Size: 4, ETag: `"d"`},
+		"pub/firefox/bundles/e": {Size: 5, ETag: `"e"`},
+		"pub/labs/f":            {Size: 6, ETag: `"f"`},
+	}
+	replica := mapObjectLister{
+		"pub/firefox/0":     {Size: 8, ETag: `"0"`},
+		"pub/firefox/a":     {Size: 1, ETag: `"a"`},
+		"pub/firefox/c":     {Size: 30, ETag: `"c"`},
+		"pub/firefox/d":     {Size: 4, ETag: `"d-2"`},
+		"pub/firefox/extra": {Size: 7, ETag: `"extra"`},
+	}
+
+	skip := func(key string) bool { return strings.HasPrefix(key, "pub/firefox/bundles/") }
+	drift, err := FindDrift(primary, replica, "pub/firefox/", skip)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Drift{
+		{Key: "pub/firefox/b", Problem: DriftMissing, Primary: ObjectInfo{2, `"b"`}},
+		{Key: "pub/firefox/c", Problem: DriftSize, Primary: ObjectInfo{3, `"c"`}, Replica: &ObjectInfo{30, `"c"`}},
+		{Key: "pub/firefox/d", Problem: DriftETag, Primary: ObjectInfo{4, `"d"`}, Replica: &ObjectInfo{4, `"d-2"`}},
+	}, drift)
+
+	drift, err = FindDrift(primary, primary, "", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, drift)
+
+	drift, err = FindDrift(mapObjectLister{"pub/firefox/a": {Size: 1, ETag: `"a"`}}, replica, "pub/", nil)
+	assert.NoError(t, err, "the replica listing stops once the primary listing ends")
+	assert.Empty(t, drift)
+
+	_, err = FindDrift(primary, errObjectLister{}, "", nil)
+	assert.Error(t, err)
+	_, err = FindDrift(errObjectLister{}, replica, "", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,163 @@
+package postupload
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var datedDirRe = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})-(\d{2})-(\d{2})-(\d{2})-(.+)$`)
+
+// DatedDir returns the directory name ToDated uses for id and branch
+func DatedDir(id *BuildID, branch string) string {
+	return fmt.Sprintf("%s-%s-%s-%s-%s-%s-%s",
+		id.Year(), id.Month(), id.Day(), id.Hour(), id.Minute(), id.Second(), branch)
+}
+
+// ParseDatedDir parses a directory name created by DatedDir
+func ParseDatedDir(dir string) (*BuildID, string, error) {
+	m := datedDirRe.FindStringSubmatch(strings.TrimSuffix(dir, "/"))
+	if m == nil {
+		return nil, "", fmt.Errorf("%s is not a dated directory", dir)
+	}
+
+	id, err := NewBuildID(strings.Join(m[1:7], ""))
+	if err != nil {
+		return nil, "", err
+	}
+	return id, m[7], nil
+}
+
+func (r *Release) datedPath(id *BuildID) string {
+	return filepath.Join(r.NightlyPath(), id.Year(), id.Month(), DatedDir(id, r.Branch))
+}
+
+// DirLister lists the directory names directly below a path
+type DirLister interface {
+	ListDirs(path string) ([]string, error)
+}
+
+// S3DirLister lists directories in an S3 bucket
+type S3DirLister struct {
+	Bucket  string
+	Service *s3.S3
+}
+
+// ListDirs returns the common prefixes below path, without trailing slashes
+func (s *S3DirLister) ListDirs(path string) ([]string, error) {
+	dirs := []string{}
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	err := s.Service.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.Bucket),
+		Delimiter: aws.String("/"),
+		Prefix:    aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, p := range page.CommonPrefixes {
+			dirs = append(dirs, strings.TrimSuffix(strings.TrimPrefix(*p.Prefix, prefix), "/"))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s/%s err: %s", s.Bucket, prefix, err)
+	}
+	return dirs, nil
+}
+
+// NightlyBuild is a dated nightly directory
+type NightlyBuild struct {
+	BuildID *BuildID
+	Branch  string
+	Path    string
+}
+
+// FindNightlies returns the dated nightlies of r.Branch built in [from, to)
+// in chronological order
+//
+// A zero from or to leaves that end of the range open. Paths are built the
+// same way as ToDated.
+func (r *Release) FindNightlies(lister DirLister, from, to time.Time) ([]*NightlyBuild, error) {
+	if r.Branch == "" {
+		return nil, fmt.Errorf("FindNightlies: Branch cannot be empty")
+	}
+
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return nil, fmt.Errorf("FindNightlies/LoadLocation: %s", err)
+	}
+
+	inRange := func(start, end time.Time) bool {
+		return (from.IsZero() || end.After(from)) && (to.IsZero() || start.Before(to))
+	}
+
+	years, err := lister.ListDirs(r.NightlyPath())
+	if err != nil {
+		return nil, err
+	}
+
+	builds := []*NightlyBuild{}
+	for _, year := range years {
+		y, err := strconv.Atoi(year)
+		if err != nil || len(year) != 4 {
+			continue
+		}
+		yearStart := time.Date(y, time.January, 1, 0, 0, 0, 0, loc)
+		if !inRange(yearStart, yearStart.AddDate(1, 0, 0)) {
+			continue
+		}
+
+		months, err := lister.ListDirs(filepath.Join(r.NightlyPath(), year))
+		if err != nil {
+			return nil, err
+		}
+		for _, month := range months {
+			m, err := strconv.Atoi(month)
+			if err != nil || len(month) != 2 || m < 1 || m > 12 {
+				continue
+			}
+			monthStart := time.Date(y, time.Month(m), 1, 0, 0, 0, 0, loc)
+			if !inRange(monthStart, monthStart.AddDate(0, 1, 0)) {
+				continue
+			}
+
+			dirs, err := lister.ListDirs(filepath.Join(r.NightlyPath(), year, month))
+			if err != nil {
+				return nil, err
+			}
+			for _, dir := range dirs {
+				id, branch, err := ParseDatedDir(dir)
+				if err != nil || branch != r.Branch {
+					continue
+				}
+				t := id.Time()
+				if (!from.IsZero() && t.Before(from)) || (!to.IsZero() && !t.Before(to)) {
+					continue
+				}
+				builds = append(builds, &NightlyBuild{
+					BuildID: id,
+					Branch:  branch,
+					Path:    r.datedPath(id),
+				})
+			}
+		}
+	}
+
+	sort.Sort(nightlyBuildsByTime(builds))
+	return builds, nil
+}
+
+type nightlyBuildsByTime []*NightlyBuild
+
+func (n nightlyBuildsByTime) Len() int { return len(n) }
+
+func (n nightlyBuildsByTime) Less(i, j int) bool {
+	return n[i].BuildID.Time().Before(n[j].BuildID.Time())
+}
+
+func (n nightlyBuildsByTime) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
@@ -0,0 +1,74 @@
+package postupload
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapDirLister map[string][]string
+
+func (m mapDirLister) ListDirs(path string) ([]string, error) {
+	return m[path], nil
+}
+
+func TestDatedDir(t *testing.T) {
+	rel := NewTestRelease()
+	rel.Branch = "mozilla-central"
+	rel.BuildID = mustBuildID("20160105030201")
+
+	dests, err := rel.ToDated("/tmp/src/firefox.tar.bz2")
+	assert.NoError(t, err)
+
+	dir := filepath.Base(filepath.Dir(filepath.Dir(dests[0])))
+	assert.Equal(t, "2016-01-05-03-02-01-mozilla-central", dir)
+
+	id, branch, err := ParseDatedDir(dir + "/")
+	assert.NoError(t, err)
+	assert.Equal(t, "20160105030201", id.String())
+	assert.Equal(t, "mozilla-central", branch)
+
+	_, _, err = ParseDatedDir("latest-mozilla-central")
+	assert.Error(t, err)
+}
+
+func TestFindNightlies(t *testing.T) {
+	lister := mapDirLister{
+		"pub/firefox/nightly":         {"2015", "2016", "latest-mozilla-central"},
+		"pub/firefox/nightly/2015":    {"12"},
+		"pub/firefox/nightly/2016":    {"01", "02"},
+		"pub/firefox/nightly/2015/12": {"2015-12-31-03-02-01-mozilla-central"},
+		"pub/firefox/nightly/2016/01": {
+			"2016-01-05-03-02-01-mozilla-central-l10n",
+			"2016-01-05-03-02-01-mozilla-central",
+			"2016-01-02-03-02-01-mozilla-central",
+			"2016-01-02-03-02-01-mozilla-aurora",
+		},
+		"pub/firefox/nightly/2016/02": {"2016-02-01-03-02-01-mozilla-central"},
+	}
+
+	rel := NewRelease("", "firefox")
+	rel.NightlyDir = "nightly"
+
+	_, err := rel.FindNightlies(lister, time.Time{}, time.Time{})
+	assert.Error(t, err, "branch is required")
+
+	rel.Branch = "mozilla-central"
+	builds, err := rel.FindNightlies(lister, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, b := range builds {
+		ids = append(ids, b.BuildID.String())
+	}
+	assert.Equal(t, []string{"20151231030201", "20160102030201", "20160105030201", "20160201030201"}, ids)
+	assert.Equal(t, "pub/firefox/nightly/2016/01/2016-01-02-03-02-01-mozilla-central", builds[1].Path)
+
+	from := mustBuildID("20160101000000").Time()
+	to := mustBuildID("20160201000000").Time()
+	builds, err = rel.FindNightlies(lister, from, to)
+	assert.NoError(t, err)
+	assert.Len(t, builds, 2)
+	assert.Equal(t, "20160102030201", builds[0].BuildID.String())
+}
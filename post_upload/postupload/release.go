@@ -41,7 +41,8 @@ func NewRelease(sourceDir, product string) *Release {
 	}
 }
 
-func (r *Release) nightlyPath() string {
+// NightlyPath returns the base directory of nightlies, ie pub/firefox/nightly
+func (r *Release) NightlyPath() string {
 	return filepath.Join(r.RootDir, r.Product, r.NightlyDir)
 }
 
@@ -149,7 +150,7 @@ func (r *Release) generateLatestPath() string {
 }
 
 func (r *Release) generateLatestPathWithSuffix(branchSuffix string) string {
-	latestPath := filepath.Join(r.nightlyPath(), "latest-"+r.Branch+branchSuffix)
+	latestPath := filepath.Join(r.NightlyPath(), "latest-"+r.Branch+branchSuffix)
 	if r.BuildDir != "" {
 		latestPath = filepath.Join(latestPath, r.BuildDir)
 	}
@@ -161,11 +162,7 @@ func (r *Release) ToDated(file string) ([]string, error) {
 	if r.BuildID == nil {
 		return nil, errors.New("BuildID cannot be empty")
 	}
-	bID := r.BuildID
-
-	longDate := fmt.Sprintf("%s-%s-%s-%s-%s-%s-%s",
-		bID.Year(), bID.Month(), bID.Day(), bID.Hour(), bID.Minute(), bID.Second(), r.Branch)
-	longDatedPath := filepath.Join(r.nightlyPath(), bID.Year(), bID.Month(), longDate)
+	longDatedPath := r.datedPath(r.BuildID)
 
 	if r.BuildDir != "" {
 		longDatedPath = filepath.Join(longDatedPath, r.BuildDir)
@@ -2,18 +2,24 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/mozilla-services/product-delivery-tools"
 )
 
-func s3Service() *s3.S3 {
-	return s3.New(deliverytools.AWSSession)
+func s3Service(bucket string) (*s3.S3, error) {
+	awsSession, err := deliverytools.AWS.Session(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(awsSession), nil
 }
 
 var s3FileCache = map[string]string{}
@@ -52,7 +58,11 @@ func s3CopyObject(src, bucket, key string) error {
 		copyInput.ContentEncoding = aws.String("gzip")
 	}
 
-	_, err := s3Service().CopyObject(copyInput)
+	svc, err := s3Service(bucket)
+	if err != nil {
+		return err
+	}
+	_, err = svc.CopyObject(copyInput)
 
 	if err != nil {
 		return fmt.Errorf("copying %s to %s/%s, err: %s", src, bucket, key, err)
@@ -80,16 +90,27 @@ func s3PutFile(src, bucket, key string) error {
 		putObjectInput.ContentType = aws.String("text/plain; charset=UTF-8")
 		putObjectInput.ContentEncoding = aws.String("gzip")
 	}
-	_, err = s3Service().PutObject(putObjectInput)
+	svc, err := s3Service(bucket)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutObject(putObjectInput)
 	if err != nil {
 		return fmt.Errorf("putting %s to %s/%s err: %s", src, bucket, key, err)
 	}
 	return nil
 }
 
-func s3CopyFile(src, bucket, key string) error {
+func s3CopyFile(src, bucket, key string, replica bool) error {
+	// replicas may be in other accounts, so they only copy from earlier
+	// uploads to the same bucket
+	cacheKey := src
+	if replica {
+		cacheKey = src + "\x00" + bucket
+	}
+
 	destKey := "/" + bucket + "/" + key
-	if cpSrc, ok := s3FileCache[src]; ok {
+	if cpSrc, ok := s3FileCache[cacheKey]; ok {
 		// File has already been copied, so move on.
 		if cpSrc == destKey {
 			return nil
@@ -101,6 +122,98 @@ func s3CopyFile(src, bucket, key string) error {
 		return err
 	}
 
-	s3FileCache[src] = destKey
+	s3FileCache[cacheKey] = destKey
+	return nil
+}
+
+// targetResult is the outcome of writing a file to one target bucket
+type targetResult struct {
+	Bucket   string
+	Required bool
+	Err      error
+}
+
+// s3CopyFileTargets copies src to key in the target buckets of mount
+//
+// Targets are written in order, primary first, and the first required target
+// which fails stops the copy, so replicas never hold a key missing from the
+// primary. The result of every attempted target is returned, with the error
+// of the failed required target.
+func s3CopyFileTargets(src string, mount deliverytools.BucketMount, key string) ([]targetResult, error) {
+	results := []targetResult{}
+	for i, target := range mount.Targets() {
+		bucket := env.Bucket(target)
+		result := targetResult{
+			Bucket:   bucket,
+			Required: mount.Required(target),
+			Err:      s3CopyFile(src, bucket, key, i > 0),
+		}
+		results = append(results, result)
+		if result.Err != nil && result.Required {
+			return results, result.Err
+		}
+	}
+	return results, nil
+}
+
+// sameCredentials returns true if buckets configured by a and b are reached
+// with the same credentials, so S3 can copy between them
+func sameCredentials(a, b deliverytools.AWSOptions) bool {
+	return a.Endpoint == b.Endpoint && a.Profile == b.Profile && a.RoleARN == b.RoleARN
+}
+
+// s3CopyBetween copies key from srcBucket to destBucket in a single part, so
+// that the copy has the ETag of the original
+//
+// Buckets sharing credentials are copied by S3, otherwise the object is
+// streamed through this host as the buckets may be in different accounts.
+func s3CopyBetween(srcBucket, destBucket, key string) error {
+	dest, err := s3Service(destBucket)
+	if err != nil {
+		return err
+	}
+
+	if sameCredentials(deliverytools.AWS.Options(srcBucket), deliverytools.AWS.Options(destBucket)) {
+		source := (&url.URL{Path: srcBucket + "/" + key}).EscapedPath()
+		_, err = dest.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(destBucket),
+			CopySource: aws.String(strings.Replace(source, "+", "%2B", -1)),
+			Key:        aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("copying %s/%s to %s err: %s", srcBucket, key, destBucket, err)
+		}
+		return nil
+	}
+
+	src, err := s3Service(srcBucket)
+	if err != nil {
+		return err
+	}
+	obj, err := src.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("getting %s/%s err: %s", srcBucket, key, err)
+	}
+	defer obj.Body.Close()
+
+	put, _ := dest.PutObjectRequest(&s3.PutObjectInput{
+		Body:            aws.ReadSeekCloser(obj.Body),
+		Bucket:          aws.String(destBucket),
+		CacheControl:    obj.CacheControl,
+		ContentEncoding: obj.ContentEncoding,
+		ContentLength:   obj.ContentLength,
+		ContentType:     obj.ContentType,
+		Key:             aws.String(key),
+	})
+	// the body can only be read once, so it is not hashed for the signature
+	// and the request is not retried
+	put.HTTPRequest.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	put.Retryer = client.DefaultRetryer{NumMaxRetries: 0}
+	if err := put.Send(); err != nil {
+		return fmt.Errorf("copying %s/%s to %s err: %s", srcBucket, key, destBucket, err)
+	}
 	return nil
 }
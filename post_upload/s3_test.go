@@ -1,8 +1,12 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/mozilla-services/product-delivery-tools"
+	"github.com/mozilla-services/product-delivery-tools/s3test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,3 +25,88 @@ func TestKeyCacheControl(t *testing.T) {
 		}
 	}
 }
+
+// setTestCredentials sets static AWS credentials for s3test and returns a
+// func restoring the previous ones
+func setTestCredentials() func() {
+	restore := map[string]*string{}
+	for name, value := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "SECRET"} {
+		if prev, ok := os.LookupEnv(name); ok {
+			restore[name] = &prev
+		} else {
+			restore[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, prev := range restore {
+			if prev == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *prev)
+			}
+		}
+	}
+}
+
+func TestS3CopyFileTargets(t *testing.T) {
+	srv := s3test.NewServer("test-firefox", "test-firefox-backup")
+	defer srv.Close()
+
+	defer func(config *deliverytools.AWSConfig, e *deliverytools.Environment, m *deliverytools.MountTree) {
+		deliverytools.AWS = config
+		env, mounts = e, m
+	}(deliverytools.AWS, env, mounts)
+	defer setTestCredentials()()
+	deliverytools.AWS = &deliverytools.AWSConfig{
+		Default: deliverytools.AWSOptions{Endpoint: srv.URL, PathStyle: true},
+	}
+	assert.NoError(t, setEnv(&deliverytools.Environment{
+		Name:         "test",
+		BucketPrefix: "test",
+		BucketMap:    deliverytools.BucketMap{Default: "archive"},
+	}))
+	s3FileCache = map[string]string{}
+
+	f, err := ioutil.TempFile("", "post_upload")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("build")
+	assert.NoError(t, err)
+	f.Close()
+
+	mount := deliverytools.BucketMount{
+		Prefix:   "pub/firefox/",
+		Bucket:   "firefox",
+		Replicas: []string{"firefox-backup"},
+	}
+	results, err := s3CopyFileTargets(f.Name(), mount, "pub/firefox/a.txt")
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	results, err = s3CopyFileTargets(f.Name(), mount, "pub/firefox/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pub/firefox/a.txt", "pub/firefox/b.txt"}, srv.Keys("test-firefox"))
+	assert.Equal(t, []string{"pub/firefox/a.txt", "pub/firefox/b.txt"}, srv.Keys("test-firefox-backup"))
+
+	mount.Replicas = []string{"firefox-missing"}
+	results, err = s3CopyFileTargets(f.Name(), mount, "pub/firefox/c.txt")
+	assert.Error(t, err, "every target is required by default")
+	assert.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.True(t, results[1].Required)
+
+	mount.Policy = deliverytools.ReplicatePrimary
+	results, err = s3CopyFileTargets(f.Name(), mount, "pub/firefox/d.txt")
+	assert.NoError(t, err, "replicas are best-effort")
+	assert.Error(t, results[1].Err)
+	assert.False(t, results[1].Required)
+	assert.Contains(t, srv.Keys("test-firefox"), "pub/firefox/d.txt")
+
+	mount.Bucket = "missing"
+	mount.Replicas = []string{"firefox-backup"}
+	results, err = s3CopyFileTargets(f.Name(), mount, "pub/firefox/e.txt")
+	assert.Error(t, err, "the primary is always required")
+	assert.Len(t, results, 1, "replicas are not written without the primary")
+	assert.NotContains(t, srv.Keys("test-firefox-backup"), "pub/firefox/e.txt")
+}
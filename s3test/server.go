@@ -0,0 +1,508 @@
+// Package s3test provides an in-memory S3 compatible server for tests
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// maxKeys is the largest page of a listing
+const maxKeys = 1000
+
+// Object is a stored object
+type Object struct {
+	Key          string
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+
+	CacheControl    string
+	ContentEncoding string
+	ContentType     string
+}
+
+// Server is an in-memory S3 compatible HTTP server
+//
+// It supports path style requests for CreateBucket, ListBuckets,
+// PutObject, CopyObject, HeadObject, GetObject, ListObjects (v1 and v2),
+// DeleteObject and DeleteObjects. Requests are not authenticated.
+type Server struct {
+	URL string
+
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*Object
+}
+
+// NewServer starts and returns a *Server with buckets, which must be closed
+// when done
+func NewServer(buckets ...string) *Server {
+	s := &Server{buckets: make(map[string]map[string]*Object)}
+	s.CreateBucket(buckets...)
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Session returns a session of s with fake credentials
+func (s *Server) Session() *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		Endpoint:         aws.String(s.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+}
+
+// CreateBucket creates empty buckets, existing buckets are unchanged
+func (s *Server) CreateBucket(buckets ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bucket := range buckets {
+		if s.buckets[bucket] == nil {
+			s.buckets[bucket] = make(map[string]*Object)
+		}
+	}
+}
+
+// Put stores body at key in bucket, creating the bucket if needed
+func (s *Server) Put(bucket, key string, body []byte) *Object {
+	s.CreateBucket(bucket)
+	obj := newObject(key, body)
+	s.mu.Lock()
+	s.buckets[bucket][key] = obj
+	s.mu.Unlock()
+	return obj
+}
+
+// Get returns the object at key in bucket, or nil
+func (s *Server) Get(bucket, key string) *Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buckets[bucket][key]
+}
+
+// Keys returns the sorted keys of bucket
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newObject(key string, body []byte) *Object {
+	sum := md5.Sum(body)
+	return &Object{
+		Key:          key,
+		Body:         body,
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestID string `xml:"RequestId"`
+}
+
+func writeError(w http.ResponseWriter, req *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if req.Method == "HEAD" {
+		return
+	}
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(&s3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  req.URL.Path,
+		RequestID: "s3test",
+	})
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) bucket(w http.ResponseWriter, req *http.Request, name string) map[string]*Object {
+	bucket := s.buckets[name]
+	if bucket == nil {
+		writeError(w, req, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	}
+	return bucket
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	query := req.URL.Query()
+
+	switch {
+	case bucket == "" && req.Method == "GET":
+		s.listBuckets(w, req)
+	case bucket == "":
+		writeError(w, req, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	case key == "" && req.Method == "PUT":
+		if s.buckets[bucket] == nil {
+			s.buckets[bucket] = make(map[string]*Object)
+		}
+	case key == "" && req.Method == "HEAD":
+		s.bucket(w, req, bucket)
+	case key == "" && req.Method == "GET":
+		s.listObjects(w, req, bucket)
+	case key == "" && req.Method == "POST" && query["delete"] != nil:
+		s.deleteObjects(w, req, bucket)
+	case key == "":
+		writeError(w, req, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	case req.Method == "PUT" && req.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, req, bucket, key)
+	case req.Method == "PUT":
+		s.putObject(w, req, bucket, key)
+	case req.Method == "GET" || req.Method == "HEAD":
+		s.getObject(w, req, bucket, key)
+	case req.Method == "DELETE":
+		if b := s.bucket(w, req, bucket); b != nil {
+			delete(b, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		writeError(w, req, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type bucket struct {
+	Name         string
+	CreationDate string
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter, req *http.Request) {
+	names := make([]string, 0, len(s.buckets))
+	for name := range s.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := &listAllMyBucketsResult{XMLNS: xmlns}
+	for _, name := range names {
+		res.Buckets = append(res.Buckets, bucket{Name: name, CreationDate: time.Unix(0, 0).UTC().Format(time.RFC3339)})
+	}
+	writeXML(w, res)
+}
+
+func (s *Server) putObject(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	b := s.bucket(w, req, bucket)
+	if b == nil {
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, req, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if md5Header := req.Header.Get("Content-MD5"); md5Header != "" {
+		sum := md5.Sum(body)
+		if md5Header != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeError(w, req, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+			return
+		}
+	}
+
+	obj := newObject(key, body)
+	setMetadata(obj, req.Header)
+	b[key] = obj
+	w.Header().Set("ETag", obj.ETag)
+}
+
+func setMetadata(obj *Object, header http.Header) {
+	obj.CacheControl = header.Get("Cache-Control")
+	obj.ContentEncoding = header.Get("Content-Encoding")
+	obj.ContentType = header.Get("Content-Type")
+	if obj.ContentType == "" {
+		obj.ContentType = "binary/octet-stream"
+	}
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	XMLNS        string   `xml:"xmlns,attr"`
+	LastModified string
+	ETag         string
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	b := s.bucket(w, req, bucket)
+	if b == nil {
+		return
+	}
+	source, err := url.Parse(req.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, req, http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key")
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		writeError(w, req, http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key")
+		return
+	}
+	src := s.buckets[parts[0]][parts[1]]
+	if src == nil {
+		writeError(w, req, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	obj := newObject(key, src.Body)
+	if strings.EqualFold(req.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		setMetadata(obj, req.Header)
+	} else {
+		obj.CacheControl = src.CacheControl
+		obj.ContentEncoding = src.ContentEncoding
+		obj.ContentType = src.ContentType
+	}
+	b[key] = obj
+
+	writeXML(w, &copyObjectResult{
+		XMLNS:        xmlns,
+		LastModified: obj.LastModified.Format("2006-01-02T15:04:05.000Z"),
+		ETag:         obj.ETag,
+	})
+}
+
+func (s *Server) getObject(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	b := s.bucket(w, req, bucket)
+	if b == nil {
+		return
+	}
+	obj := b[key]
+	if obj == nil {
+		writeError(w, req, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	header := w.Header()
+	header.Set("ETag", obj.ETag)
+	header.Set("Content-Type", obj.ContentType)
+	if obj.CacheControl != "" {
+		header.Set("Cache-Control", obj.CacheControl)
+	}
+	if obj.ContentEncoding != "" {
+		header.Set("Content-Encoding", obj.ContentEncoding)
+	}
+	// handles Range and conditional requests the way S3 does
+	http.ServeContent(w, req, "", obj.LastModified, bytes.NewReader(obj.Body))
+}
+
+type deleteRequest struct {
+	Quiet   bool
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Deleted []deleted
+}
+
+type deleted struct {
+	Key string
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, req *http.Request, bucket string) {
+	b := s.bucket(w, req, bucket)
+	if b == nil {
+		return
+	}
+	input := new(deleteRequest)
+	if err := xml.NewDecoder(req.Body).Decode(input); err != nil {
+		writeError(w, req, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+		return
+	}
+
+	res := &deleteResult{XMLNS: xmlns}
+	for _, obj := range input.Objects {
+		delete(b, obj.Key)
+		if !input.Quiet {
+			res.Deleted = append(res.Deleted, deleted{Key: obj.Key})
+		}
+	}
+	writeXML(w, res)
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	XMLNS                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Marker                *string
+	NextMarker            string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              *int
+	MaxKeys               int
+	Delimiter             string `xml:",omitempty"`
+	IsTruncated           bool
+	Contents              []listObject
+	CommonPrefixes        []commonPrefix
+}
+
+type listObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, req *http.Request, bucket string) {
+	b := s.bucket(w, req, bucket)
+	if b == nil {
+		return
+	}
+	query := req.URL.Query()
+	v2 := query.Get("list-type") == "2"
+
+	res := &listBucketResult{
+		XMLNS:     xmlns,
+		Name:      bucket,
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   maxKeys,
+	}
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, req, http.StatusBadRequest, "InvalidArgument", "Provided max-keys not an integer or within integer range")
+			return
+		}
+		if n < maxKeys {
+			res.MaxKeys = n
+		}
+	}
+
+	after := ""
+	if v2 {
+		res.StartAfter = query.Get("start-after")
+		after = res.StartAfter
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.StdEncoding.DecodeString(token)
+			if err != nil {
+				writeError(w, req, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+				return
+			}
+			res.ContinuationToken = token
+			after = string(decoded)
+		}
+	} else {
+		marker := query.Get("marker")
+		res.Marker = &marker
+		after = marker
+	}
+
+	keys := make([]string, 0, len(b))
+	for key := range b {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	count := 0
+	last := ""
+	for _, key := range keys {
+		if !strings.HasPrefix(key, res.Prefix) {
+			continue
+		}
+		name := key
+		isPrefix := false
+		if res.Delimiter != "" {
+			if i := strings.Index(key[len(res.Prefix):], res.Delimiter); i >= 0 {
+				name = key[:len(res.Prefix)+i+len(res.Delimiter)]
+				isPrefix = true
+			}
+		}
+		if name <= after || name == last {
+			continue
+		}
+		if count == res.MaxKeys {
+			res.IsTruncated = true
+			break
+		}
+
+		last = name
+		count++
+		if isPrefix {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: name})
+			continue
+		}
+		obj := b[key]
+		res.Contents = append(res.Contents, listObject{
+			Key:          key,
+			LastModified: obj.LastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         obj.ETag,
+			Size:         len(obj.Body),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	if v2 {
+		res.KeyCount = &count
+		if res.IsTruncated {
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+		}
+	} else if res.IsTruncated && res.Delimiter != "" {
+		res.NextMarker = last
+	}
+	writeXML(w, res)
+}
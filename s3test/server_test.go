@@ -0,0 +1,129 @@
+package s3test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerObjects(t *testing.T) {
+	srv := NewServer("bucket")
+	defer srv.Close()
+	svc := s3.New(srv.Session())
+
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String("bucket"),
+		Key:          aws.String("dir/a b.txt"),
+		Body:         strings.NewReader("hello world"),
+		ContentType:  aws.String("text/plain"),
+		CacheControl: aws.String("max-age=60"),
+	})
+	assert.NoError(t, err)
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/a b.txt")})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), aws.Int64Value(head.ContentLength))
+	assert.Equal(t, "text/plain", aws.StringValue(head.ContentType))
+	assert.Equal(t, "max-age=60", aws.StringValue(head.CacheControl))
+	assert.Equal(t, srv.Get("bucket", "dir/a b.txt").ETag, aws.StringValue(head.ETag))
+
+	get, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("dir/a b.txt"),
+		Range:  aws.String("bytes=6-"),
+	})
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(get.Body)
+		get.Body.Close()
+		assert.Equal(t, "world", string(body))
+		assert.Equal(t, "bytes 6-10/11", aws.StringValue(get.ContentRange))
+	}
+
+	_, err = svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("copy.txt"),
+		CopySource:  aws.String("/bucket/dir/a b.txt"),
+		ContentType: aws.String("application/octet-stream"),
+	})
+	assert.NoError(t, err)
+	copied := srv.Get("bucket", "copy.txt")
+	if assert.NotNil(t, copied) {
+		assert.Equal(t, "hello world", string(copied.Body))
+		assert.Equal(t, "text/plain", copied.ContentType, "metadata is copied unless replaced")
+	}
+
+	_, err = svc.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("missing")})
+	if aerr, ok := err.(awserr.Error); assert.True(t, ok) {
+		assert.Equal(t, "NoSuchKey", aerr.Code())
+	}
+	_, err = svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("other"), Key: aws.String("key")})
+	assert.Error(t, err)
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("copy.txt")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/a b.txt"}, srv.Keys("bucket"))
+
+	srv.Put("bucket", "x", nil)
+	res, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{
+			{Key: aws.String("dir/a b.txt")},
+			{Key: aws.String("x")},
+		}},
+	})
+	if assert.NoError(t, err) {
+		assert.Len(t, res.Deleted, 2)
+	}
+	assert.Empty(t, srv.Keys("bucket"))
+}
+
+func TestServerList(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	for _, key := range []string{"a/1", "a/2", "b", "c/1", "c/2/3", "d"} {
+		srv.Put("bucket", key, []byte(key))
+	}
+	svc := s3.New(srv.Session())
+
+	names := []string{}
+	err := svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String("bucket"),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int64(2),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		assert.True(t, aws.Int64Value(page.KeyCount) <= 2)
+		for _, cp := range page.CommonPrefixes {
+			names = append(names, *cp.Prefix)
+		}
+		for _, obj := range page.Contents {
+			names = append(names, *obj.Key)
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/", "b", "c/", "d"}, names)
+
+	keys := []string{}
+	err = svc.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket:  aws.String("bucket"),
+		Prefix:  aws.String("c/"),
+		MaxKeys: aws.Int64(1),
+	}, func(page *s3.ListObjectsOutput, last bool) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c/1", "c/2/3"}, keys)
+
+	buckets, err := svc.ListBuckets(&s3.ListBucketsInput{})
+	if assert.NoError(t, err) && assert.Len(t, buckets.Buckets, 1) {
+		assert.Equal(t, "bucket", *buckets.Buckets[0].Name)
+	}
+}